@@ -44,6 +44,25 @@ type Config struct {
 	WalletName              string
 	WalletPassword          string
 	WalletAutoRefreshPeriod uint32
+
+	// Exchange Rate Configuration
+	RatesProviders        string // Comma separated, tried in order: static, file, coingecko
+	RatesStatic           string // Static table, e.g. "EUR:150.25,USD:162.10"
+	RatesFile             string // JSON file mapping currency codes to the price of 1 XMR
+	RatesCacheTTL         uint32 // Seconds
+	RatesTolerancePercent float64
+	CoinGeckoBaseURL      string
+	CoinGeckoAPIKey       string
+
+	// Event Broker Configuration
+	EventBroker string // local (single instance) or postgres (LISTEN/NOTIFY across instances)
+}
+
+// PostgresDSN applies server-side timeouts across pooled connections via options
+func (c *Config) PostgresDSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable connect_timeout=5 "+
+		"options='-c statement_timeout=15s -c idle_in_transaction_session_timeout=15s'",
+		c.DBHost, c.DBUser, c.DBPassword, c.DBName, c.DBPort)
 }
 
 func LoadConfig() (*Config, error) {
@@ -86,6 +105,18 @@ func LoadConfig() (*Config, error) {
 		// Wallet Settings
 		WalletName:     os.Getenv("WALLET_NAME"),
 		WalletPassword: os.Getenv("WALLET_PASSWORD"),
+
+		// Exchange Rate Configuration
+		RatesProviders:        os.Getenv("RATES_PROVIDERS"),
+		RatesStatic:           os.Getenv("RATES_STATIC"),
+		RatesFile:             os.Getenv("RATES_FILE"),
+		RatesCacheTTL:         60,
+		RatesTolerancePercent: 2,
+		CoinGeckoBaseURL:      os.Getenv("COINGECKO_BASE_URL"),
+		CoinGeckoAPIKey:       os.Getenv("COINGECKO_API_KEY"),
+
+		// Event Broker Configuration
+		EventBroker: os.Getenv("EVENT_BROKER"),
 	}
 
 	if period := os.Getenv("WALLET_AUTO_REFRESH_PERIOD"); period != "" {
@@ -96,6 +127,30 @@ func LoadConfig() (*Config, error) {
 		config.WalletAutoRefreshPeriod = uint32(value)
 	}
 
+	if ttl := os.Getenv("RATES_CACHE_TTL"); ttl != "" {
+		value, err := strconv.ParseUint(ttl, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RATES_CACHE_TTL: %s", ttl)
+		}
+		config.RatesCacheTTL = uint32(value)
+	}
+
+	if tolerance := os.Getenv("RATES_TOLERANCE_PERCENT"); tolerance != "" {
+		value, err := strconv.ParseFloat(tolerance, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid RATES_TOLERANCE_PERCENT: %s", tolerance)
+		}
+		config.RatesTolerancePercent = value
+	}
+
+	switch config.EventBroker {
+	case "":
+		config.EventBroker = "local"
+	case "local", "postgres":
+	default:
+		return nil, fmt.Errorf("invalid EVENT_BROKER: %s", config.EventBroker)
+	}
+
 	// Validate required fields
 	if config.AdminName == "" ||
 		config.AdminPassword == "" ||
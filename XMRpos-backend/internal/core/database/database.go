@@ -12,12 +12,7 @@ import (
 )
 
 func NewPostgresClient(cfg *config.Config) (*gorm.DB, error) {
-	// Apply server-side timeouts across pooled connections via options
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable connect_timeout=5 "+
-        "options='-c statement_timeout=15s -c idle_in_transaction_session_timeout=15s'",
-        cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(cfg.PostgresDSN()), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to target database: %w", err)
 	}
@@ -43,9 +38,21 @@ func NewPostgresClient(cfg *config.Config) (*gorm.DB, error) {
 		&models.Invite{},
 		&models.Transaction{},
 		&models.SubTransaction{},
+		&models.ReorgEvent{},
+		&models.LineItem{},
 		&models.Pos{},
 		&models.Vendor{},
 		&models.Transfer{},
+		&models.Refund{},
+		&models.IdempotencyKey{},
+		&models.Category{},
+		&models.Product{},
+		&models.StockItem{},
+		&models.StockReservation{},
+		&models.StockAdjustment{},
+		&models.TaxRate{},
+		&models.Promotion{},
+		&models.DisplaySession{},
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Advisory lock keys of the background workers, one instance at a time runs each of them
+const (
+	LockTransferCompleter   int64 = 7301
+	LockConfirmationChecker int64 = 7302
+)
+
+// RunExclusive runs fn while holding the advisory lock key, so that with several instances only one runs it.
+// It reports false without running fn when another instance holds the lock.
+func RunExclusive(ctx context.Context, gormDB *gorm.DB, key int64, fn func(ctx context.Context)) (bool, error) {
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return false, err
+	}
+	// A session lock belongs to the connection, so it is taken and released on the same one
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			log.Printf("Failed to release advisory lock %d: %v", key, err)
+			// Drop the connection instead of returning it to the pool still holding the lock
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	fn(ctx)
+	return true, nil
+}
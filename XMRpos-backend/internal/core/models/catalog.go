@@ -0,0 +1,34 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type Category struct {
+	gorm.Model
+	VendorID  uint   `gorm:"not null;index"` // Foreign key field
+	Vendor    Vendor `gorm:"foreignKey:VendorID"`
+	Name      string `gorm:"not null;type:text"`
+	SortOrder int64  `gorm:"not null;default:0"`
+	Active    bool   `gorm:"not null;default:true"`
+	Version   int64  `gorm:"not null;index"` // Vendor catalog version of the last change
+}
+
+type Product struct {
+	gorm.Model
+	VendorID         uint      `gorm:"not null;index"` // Foreign key field
+	Vendor           Vendor    `gorm:"foreignKey:VendorID"`
+	CategoryID       *uint     `gorm:"index"` // Foreign key, nullable for uncategorized products
+	Category         *Category `gorm:"foreignKey:CategoryID"`
+	Name             string    `gorm:"not null;type:text"`
+	SKU              *string   `gorm:"type:text;index"`
+	Description      *string   `gorm:"type:text"`
+	Price            float64   `gorm:"not null"` // In Currency
+	Currency         string    `gorm:"not null"`
+	TaxRate          *float64  `gorm:"default:null"` // Percentage
+	Image            []byte    `gorm:"type:bytea"`   // PNG or JPEG
+	ImageContentType *string   `gorm:"type:text"`
+	ImageHash        *string   `gorm:"type:text"` // SHA-256 of Image, doubles as its ETag
+	Active           bool      `gorm:"not null;default:true"`
+	Version          int64     `gorm:"not null;index"` // Vendor catalog version of the last change
+}
@@ -0,0 +1,19 @@
+package models
+
+// Bounds for the confirmations after which a payment counts as settled (Confirmed).
+// Received funds unlock after 10 blocks, so a lower threshold could not settle them any sooner.
+const (
+	DefaultFinalConfirmations = 10
+	MinFinalConfirmations     = 10
+	MaxFinalConfirmations     = 720
+)
+
+// MaxConfirmationTiers limits the amount tiers of a confirmation policy
+const MaxConfirmationTiers = 10
+
+// ConfirmationTier accepts sales worth less than Below in Currency after Confirmations
+type ConfirmationTier struct {
+	Below         float64 `json:"below"`
+	Currency      string  `json:"currency"`
+	Confirmations int64   `json:"confirmations"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What a paired customer display shows
+const (
+	DisplayStateIdle    = "idle"    // Vendor branding
+	DisplayStateCart    = "cart"    // The cart or amount being rung up
+	DisplayStatePayment = "payment" // A transaction, from the QR code until it is paid
+)
+
+// DisplaySession is a customer facing screen. It shows a pairing code until a POS claims it,
+// then it follows whatever that POS puts on it.
+type DisplaySession struct {
+	gorm.Model
+	VendorID         *uint      `gorm:"index"` // Set once paired
+	PosID            *uint      `gorm:"index"` // Set once paired
+	Name             *string    `gorm:"type:text"`
+	Token            string     `gorm:"not null;type:text;uniqueIndex"` // Secret the display streams with
+	PairingCode      *string    `gorm:"type:text;uniqueIndex"`          // Cleared once paired
+	PairingExpiresAt *time.Time `gorm:"default:null"`
+	PairedAt         *time.Time `gorm:"default:null"`
+	State            string     `gorm:"not null;default:idle"`
+	Cart             *string    `gorm:"type:text"` // JSON of the cart in the cart state
+	TransactionID    *uint      `gorm:"index"`     // Transaction in the payment state
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey remembers the outcome of a POS request so that retries return the original response
+type IdempotencyKey struct {
+	gorm.Model
+	PosID         uint    `gorm:"not null;uniqueIndex:idx_idempotency_keys_pos_key"` // Foreign key field
+	Pos           Pos     `gorm:"foreignKey:PosID"`
+	Key           string  `gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_pos_key"`
+	RequestHash   string  `gorm:"size:64;not null"`
+	TransactionID *uint   `gorm:"index"` // Set once the request completed
+	Response      *string `gorm:"type:text"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	StockReservationStatusReserved = "reserved"
+	StockReservationStatusDeducted = "deducted"
+	StockReservationStatusReleased = "released"
+)
+
+const (
+	StockAdjustmentReasonSale       = "sale"
+	StockAdjustmentReasonRestock    = "restock"
+	StockAdjustmentReasonCorrection = "correction"
+	StockAdjustmentReasonLoss       = "loss"
+)
+
+type StockItem struct {
+	gorm.Model
+	VendorID          uint   `gorm:"not null;uniqueIndex:idx_stock_items_vendor_sku"` // Foreign key field
+	Vendor            Vendor `gorm:"foreignKey:VendorID"`
+	SKU               string `gorm:"not null;type:text;uniqueIndex:idx_stock_items_vendor_sku"`
+	Quantity          int64  `gorm:"not null;default:0"` // On hand, including reserved units
+	Reserved          int64  `gorm:"not null;default:0"` // Held by transactions that are not paid yet
+	LowStockThreshold *int64 `gorm:"default:null"`
+}
+
+// StockReservation holds units of a SKU for a transaction until it is accepted or abandoned
+type StockReservation struct {
+	gorm.Model
+	VendorID      uint   `gorm:"not null;index"`
+	TransactionID uint   `gorm:"not null;index"` // Foreign key field
+	StockItemID   uint   `gorm:"not null;index"` // Foreign key field
+	SKU           string `gorm:"not null;type:text"`
+	Quantity      int64  `gorm:"not null"`
+	Status        string `gorm:"not null;default:'reserved'"`
+}
+
+type StockAdjustment struct {
+	gorm.Model
+	VendorID      uint    `gorm:"not null;index"`
+	StockItemID   uint    `gorm:"not null;index"` // Foreign key field
+	SKU           string  `gorm:"not null;type:text"`
+	Delta         int64   `gorm:"not null"`
+	Reason        string  `gorm:"not null"`
+	Note          *string `gorm:"type:text"`
+	TransactionID *uint   `gorm:"index"` // Set for sales
+	QuantityAfter int64   `gorm:"not null"`
+}
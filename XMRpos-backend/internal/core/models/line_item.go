@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type LineItem struct {
+	gorm.Model
+	TransactionID uint     `gorm:"not null;index"` // Foreign key field
+	Name          string   `gorm:"not null;type:text"`
+	SKU           *string  `gorm:"type:text;index"`
+	Quantity      int64    `gorm:"not null"`
+	UnitPrice     float64  `gorm:"not null"`     // In the transaction currency
+	TaxRate       *float64 `gorm:"default:null"` // Percentage
+	Total         float64  `gorm:"not null"`     // Quantity * UnitPrice, rounded to cents
+}
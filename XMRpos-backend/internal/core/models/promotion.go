@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PromotionTypePercentage = "percentage"
+	PromotionTypeFixed      = "fixed"
+)
+
+type Promotion struct {
+	gorm.Model
+	VendorID uint       `gorm:"not null;uniqueIndex:idx_promotions_vendor_code,where:deleted_at IS NULL"` // Foreign key field
+	Vendor   Vendor     `gorm:"foreignKey:VendorID"`
+	Code     string     `gorm:"not null;type:text;uniqueIndex:idx_promotions_vendor_code,where:deleted_at IS NULL"` // Upper case
+	Name     *string    `gorm:"type:text"`
+	Type     string     `gorm:"not null"`
+	Value    float64    `gorm:"not null"`  // Percentage, or fixed amount in Currency
+	Currency *string    `gorm:"type:text"` // Sales in other currencies do not qualify, required for fixed discounts and MinSpend
+	MinSpend *float64   `gorm:"default:null"`
+	StartsAt *time.Time `gorm:"default:null"`
+	EndsAt   *time.Time `gorm:"default:null"`
+	MaxUses  *int64     `gorm:"default:null"`
+	Uses     int64      `gorm:"not null;default:0"` // Sales that used the code and were not abandoned
+	Active   bool       `gorm:"not null;default:true"`
+	Pos      []Pos      `gorm:"many2many:promotion_pos"` // Empty when every POS of the vendor may use it
+}
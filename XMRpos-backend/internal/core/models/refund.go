@@ -0,0 +1,27 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// MaxRefundAttempts is how often a refund is sent before it is given up as failed
+const MaxRefundAttempts = 5
+
+type Refund struct {
+	gorm.Model
+	VendorID       uint        `gorm:"not null;index"` // Foreign key field
+	Vendor         Vendor      `gorm:"foreignKey:VendorID"`
+	TransactionID  uint        `gorm:"not null;index"` // Foreign key field
+	Transaction    Transaction `gorm:"foreignKey:TransactionID"`
+	Address        string      `gorm:"not null;type:text"`
+	Amount         int64       `gorm:"not null"`     // Amount to be refunded
+	AmountRefunded *int64      `gorm:"default:null"` // Amount that reached the customer (amount - fee)
+	Fee            *int64      `gorm:"default:null"`
+	Reason         *string     `gorm:"type:text"`
+	FromExcess     bool        `gorm:"not null;default:false"` // Paid from an overpayment, so not charged to the vendor balance
+	TransferID     *uint       `gorm:"index"`                  // Vendor payout the refund was deducted from, nullable until then
+	TxHash         *string     `gorm:"type:text"`
+	Completed      bool        `gorm:"not null;default:false"` // Indicates if the refund has been sent
+	Attempts       int         `gorm:"not null;default:0"`     // Failed sends, the refund is given up after MaxRefundAttempts
+	LastError      *string     `gorm:"type:text"`
+}
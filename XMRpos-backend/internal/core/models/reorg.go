@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// How a received payment was affected by a blockchain reorganization
+const (
+	ReorgKindVanished      = "vanished"       // The wallet no longer reports the payment
+	ReorgKindHeightChanged = "height_changed" // The payment was mined into another block or went back to the pool
+)
+
+// ReorgEvent records a payment that moved after it had been seen in a block
+type ReorgEvent struct {
+	gorm.Model
+	TransactionID         uint   `gorm:"not null;index"` // Foreign key field
+	SubTransactionID      uint   `gorm:"not null;index"`
+	TxHash                string `gorm:"not null"`
+	Kind                  string `gorm:"not null"`
+	PreviousHeight        int64  `gorm:"not null"`
+	Height                int64  `gorm:"not null"` // 0 once vanished or back in the pool
+	PreviousConfirmations int64  `gorm:"not null"`
+	Confirmations         int64  `gorm:"not null"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type TaxRate struct {
+	gorm.Model
+	VendorID uint    `gorm:"not null;index"` // Foreign key field
+	Vendor   Vendor  `gorm:"foreignKey:VendorID"`
+	Name     string  `gorm:"not null;type:text"`
+	Rate     float64 `gorm:"not null"`               // Percentage
+	Default  bool    `gorm:"not null;default:false"` // Applied when a sale does not pick a rate
+}
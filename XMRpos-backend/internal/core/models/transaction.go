@@ -6,6 +6,34 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	TransactionStatusPending   = "pending"
+	TransactionStatusPaid      = "paid"
+	TransactionStatusExpired   = "expired"
+	TransactionStatusCancelled = "cancelled"
+	TransactionStatusUnderpaid = "underpaid"
+	TransactionStatusOverpaid  = "overpaid"
+)
+
+// How a vendor resolved an underpaid or overpaid transaction
+const (
+	PaymentResolutionShortAccepted  = "short_accepted"
+	PaymentResolutionTopUpRequested = "top_up_requested"
+	PaymentResolutionExcessRefund   = "excess_refund"
+)
+
+// How the tip on a transaction was chosen
+const (
+	TipTypeFixed      = "fixed"
+	TipTypePercentage = "percentage"
+)
+
+// Bounds for how long a transaction may wait for payment before it expires
+const (
+	MinTransactionExpirySeconds = 60
+	MaxTransactionExpirySeconds = 24 * 60 * 60
+)
+
 type Transaction struct {
 	gorm.Model
 	VendorID              uint              `gorm:"not null;index"` // Foreign key field
@@ -14,14 +42,45 @@ type Transaction struct {
 	Pos                   Pos               `gorm:"foreignKey:PosID"`
 	Amount                int64             `gorm:"not null"`
 	RequiredConfirmations int64             `gorm:"not null"`
+	FinalConfirmations    int64             `gorm:"not null;default:10"` // Confirmations after which the payment is settled, from the vendor policy at sale time
 	Currency              string            `gorm:"not null"`
 	AmountInCurrency      float64           `gorm:"not null"`
+	TipType               *string           `gorm:"type:text"`
+	TipPercentage         *float64          `gorm:"default:null"`
+	TipAmount             int64             `gorm:"not null;default:0"`     // Part of Amount that is a tip
+	TipAmountInCurrency   float64           `gorm:"not null;default:0"`     // Part of AmountInCurrency that is a tip
+	TaxRateID             *uint             `gorm:"index"`                  // Foreign key, nil for sales without tax
+	TaxName               *string           `gorm:"type:text"`              // Name of the tax rate at sale time
+	TaxRate               *float64          `gorm:"default:null"`           // Percentage applied at sale time
+	TaxInclusive          bool              `gorm:"not null;default:false"` // The entered price already included the tax
+	NetAmountInCurrency   float64           `gorm:"not null;default:0"`     // Sale before tax, without the tip
+	TaxAmountInCurrency   float64           `gorm:"not null;default:0"`
+	GrossAmountInCurrency float64           `gorm:"not null;default:0"` // Net plus tax, AmountInCurrency minus the tip
+	PromotionID           *uint             `gorm:"index"`              // Foreign key, set when a discount code was applied
+	PromotionCode         *string           `gorm:"type:text"`
+	DiscountInCurrency    float64           `gorm:"not null;default:0"` // Taken off the entered price, before tax
+	ExchangeRate          *float64          `gorm:"default:null"`       // Price of 1 XMR in Currency applied at sale time
+	ExchangeRateSource    *string           `gorm:"type:text"`
+	ExchangeRateAt        *time.Time        `gorm:"default:null"`
 	Description           *string           `gorm:"type:text"`
 	SubAddress            *string           `gorm:"type:text"`
+	PublicToken           *string           `gorm:"type:text;uniqueIndex"` // Lets the customer follow the payment without an account
 	Accepted              bool              `gorm:"not null;default:false"`
 	Confirmed             bool              `gorm:"not null;default:false"`
 	Transferred           bool              `gorm:"not null;default:false"`
+	Status                string            `gorm:"not null;default:pending;index"`
+	ExpiresAt             *time.Time        `gorm:"index"`
+	LatePayment           bool              `gorm:"not null;default:false"` // Payment arrived after the transaction expired or was cancelled
+	AmountReceived        int64             `gorm:"not null;default:0"`
+	AmountShortfall       int64             `gorm:"not null;default:0"` // Amount missing when underpaid (kept after the short amount is accepted)
+	AmountExcess          int64             `gorm:"not null;default:0"` // Amount sent on top of the requested amount
+	PaymentResolution     *string           `gorm:"type:text"`
+	DoubleSpendSeen       bool              `gorm:"not null;default:false"`       // A payment is currently reported as double-spent
+	ReviewRequired        bool              `gorm:"not null;default:false;index"` // Held back from transfers until the vendor releases it
+	ReorgPending          bool              `gorm:"not null;default:false;index"` // A payment moved in a reorg, payouts wait until it is confirmed again
 	SubTransactions       []*SubTransaction `gorm:"foreignKey:TransactionID"`
+	ReorgEvents           []*ReorgEvent     `gorm:"foreignKey:TransactionID"`
+	LineItems             []*LineItem       `gorm:"foreignKey:TransactionID"`
 	TransferID            *uint             `gorm:"index"` // Foreign key, nullable if not all transactions are transferred
 	Transfer              *Transfer         `gorm:"foreignKey:TransferID"`
 }
@@ -38,4 +97,5 @@ type SubTransaction struct {
 	TxHash          string    `gorm:"not null"`
 	UnlockTime      int64     `gorm:"not null"`
 	Locked          bool      `gorm:"not null"`
+	Orphaned        bool      `gorm:"not null;default:false"` // No longer reported by the wallet, left out until it shows up again
 }
@@ -13,5 +13,6 @@ type Transfer struct {
 	Address           string         `gorm:"not null;type:text"`
 	TxHash            *string        `gorm:"type:text"`
 	Transactions      []*Transaction `gorm:"foreignKey:TransferID"`
+	Refunds           []*Refund      `gorm:"foreignKey:TransferID"`  // Refunds deducted from this transfer
 	Completed         bool           `gorm:"not null;default:false"` // Indicates if the transfer is completed
 }
@@ -12,6 +12,15 @@ type Vendor struct {
 	MoneroSubaddress string       `gorm:"not null"`
 	Pos             []Pos         `gorm:"foreignKey:VendorID"` // One-to-many relationship with Pos
 	Balance         int64         `gorm:"not null;default:0"`
+	TransactionExpirySeconds int64 `gorm:"not null;default:900"` // Default lifetime of a new transaction
+	ReceiptCompanyName *string    `gorm:"type:text"`
+	ReceiptHeader      *string    `gorm:"type:text"` // Lines printed under the company name, such as the address
+	ReceiptFooter      *string    `gorm:"type:text"`
+	ReceiptLogo        []byte     `gorm:"type:bytea"` // PNG or JPEG
+	CatalogVersion     int64      `gorm:"not null;default:0"` // Bumped on every catalog change, used for sync
+	PricesIncludeTax   bool       `gorm:"not null;default:true"` // Whether entered prices are gross (tax inclusive) or net
+	FinalConfirmations int64      `gorm:"not null;default:10"` // Confirmations after which a payment counts as settled
+	ConfirmationTiers  []ConfirmationTier `gorm:"serializer:json;type:jsonb"` // Confirmations a sale needs to be accepted, by amount, ascending
 	Transactions    []Transaction `gorm:"foreignKey:VendorID"` // One-to-many relationship with Transactions
 	/* WalletAddress   string        `gorm:"not null"` */ // TODO: this will be useful when MoneroPay has implemented mutiple wallets per instance
 }
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,8 +13,14 @@ import (
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/admin"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/auth"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/callback"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/catalog"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/inventory"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/misc"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/pos"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/promotion"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/rates"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/receipt"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/status"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/vendor"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
 
@@ -52,16 +59,36 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 	posRepository := pos.NewPosRepository(db)
 	callbackRepository := callback.NewCallbackRepository(db)
 	miscRepository := misc.NewMiscRepository(db)
+	receiptRepository := receipt.NewReceiptRepository(db)
+	catalogRepository := catalog.NewCatalogRepository(db)
+	inventoryRepository := inventory.NewInventoryRepository(db)
+	promotionRepository := promotion.NewPromotionRepository(db)
+	statusRepository := status.NewStatusRepository(db)
+
+	// Live updates reach the clients of every instance through the database
+	if cfg.EventBroker == "postgres" {
+		broker := pos.NewPostgresBroker(db, cfg.PostgresDSN(), posRepository)
+		go broker.Listen(ctx)
+		pos.SetBroker(broker)
+	} else {
+		pos.SetBroker(pos.NewLocalBroker(posRepository))
+	}
 
 	// Initialize services
 	adminService := admin.NewAdminService(adminRepository, cfg)
 	authService := auth.NewAuthService(authRepository, cfg)
 	vendorService := vendor.NewVendorService(vendorRepository, db, cfg, rpcClient, moneroPayClient)
 	vendorService.StartTransferCompleter(ctx, 30*time.Second) // Check every 30 seconds
-	posService := pos.NewPosService(posRepository, cfg, moneroPayClient)
-	callbackService := callback.NewCallbackService(callbackRepository, cfg, moneroPayClient)
+	ratesService := rates.NewRatesService(cfg)
+	posService := pos.NewPosService(posRepository, cfg, moneroPayClient, ratesService)
+	callbackService := callback.NewCallbackService(callbackRepository, db, cfg, moneroPayClient)
 	callbackService.StartConfirmationChecker(ctx, 2*time.Second) // Check for confirmations every 2 seconds
 	miscService := misc.NewMiscService(miscRepository, cfg, moneroPayClient)
+	receiptService := receipt.NewReceiptService(receiptRepository)
+	catalogService := catalog.NewCatalogService(catalogRepository)
+	inventoryService := inventory.NewInventoryService(inventoryRepository)
+	promotionService := promotion.NewPromotionService(promotionRepository)
+	statusService := status.NewStatusService(statusRepository)
 
 	// Initialize handlers
 	adminHandler := admin.NewAdminHandler(adminService, vendorService)
@@ -70,6 +97,14 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 	posHandler := pos.NewPosHandler(posService)
 	callbackHandler := callback.NewCallbackHandler(callbackService)
 	miscHandler := misc.NewMiscHandler(miscService)
+	ratesHandler := rates.NewRatesHandler(ratesService)
+	receiptHandler := receipt.NewReceiptHandler(receiptService)
+	catalogHandler := catalog.NewCatalogHandler(catalogService)
+	inventoryHandler := inventory.NewInventoryHandler(inventoryService)
+	promotionHandler := promotion.NewPromotionHandler(promotionService)
+	statusHandler := status.NewStatusHandler(statusService)
+
+	authMiddleware := localMiddleware.AuthMiddleware(cfg, authRepository)
 
 	// Public routes
 	r.Group(func(r chi.Router) {
@@ -86,13 +121,30 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 		r.Post("/callback/receive/{jwt}", callbackHandler.ReceiveTransaction)
 		r.Post("/receive/{jwt}", callbackHandler.ReceiveTransaction)
 
+		// Customer payment status, authorized by the public token of the transaction
+		r.Get("/public/transaction/{token}", statusHandler.GetStatus)
+		r.Get("/public/transaction/{token}/page", statusHandler.GetStatusPage)
+
+		// EventSource cannot send an Authorization header, so the transaction stream also takes a ?ticket=
+		r.Get("/pos/sse/transaction", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Has("ticket") {
+				posHandler.TransactionSSE(w, r)
+				return
+			}
+			authMiddleware(http.HandlerFunc(posHandler.TransactionSSE)).ServeHTTP(w, r)
+		})
+
+		// Customer displays, authorized by the token of their display session
+		r.Post("/display/sessions", posHandler.CreateDisplaySession)
+		r.Get("/display/stream", posHandler.DisplayStream)
+
 		// Miscellaneous routes
 		r.Get("/misc/health", miscHandler.GetHealth)
 	})
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
-		r.Use(localMiddleware.AuthMiddleware(cfg, authRepository))
+		r.Use(authMiddleware)
 
 		// Auth routes
 		r.Post("/auth/update-password", authHandler.UpdatePassword)
@@ -107,12 +159,68 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 		r.Post("/vendor/delete", vendorHandler.DeleteVendor)
 		r.Post("/vendor/create-pos", vendorHandler.CreatePos)
 		r.Get("/vendor/balance", vendorHandler.GetAccountBalance)
+		r.Get("/vendor/settings", vendorHandler.GetSettings)
+		r.Post("/vendor/update-settings", vendorHandler.UpdateSettings)
+		r.Post("/vendor/transaction/{id}/resolve", vendorHandler.ResolveTransaction)
+		r.Post("/vendor/transaction/{id}/refund", vendorHandler.CreateRefund)
+		r.Get("/vendor/refunds", vendorHandler.ListRefunds)
+		r.Post("/vendor/refunds/{id}/retry", vendorHandler.RetryRefund)
+		r.Post("/vendor/refunds/{id}/cancel", vendorHandler.CancelRefund)
+		r.Get("/vendor/transactions", vendorHandler.ListTransactions)
+		r.Get("/vendor/transactions/{id}", vendorHandler.GetTransaction)
+		r.Get("/vendor/export", vendorHandler.Export)
+		r.Get("/vendor/reports/tips", vendorHandler.TipReport)
+		r.Get("/vendor/reports/items", vendorHandler.ItemSalesReport)
+		r.Get("/vendor/reports/tax", vendorHandler.TaxReport)
+		r.Get("/vendor/tax-rates", vendorHandler.ListTaxRates)
+		r.Post("/vendor/tax-rates", vendorHandler.CreateTaxRate)
+		r.Post("/vendor/tax-rates/{id}/update", vendorHandler.UpdateTaxRate)
+		r.Post("/vendor/tax-rates/{id}/delete", vendorHandler.DeleteTaxRate)
+		r.Get("/vendor/transactions/{id}/receipt", receiptHandler.GetReceipt)
+		r.HandleFunc("/vendor/ws/events", vendorHandler.EventsWS)
 
 		// POS routes
 		r.Post("/pos/create-transaction", posHandler.CreateTransaction)
 		r.Get("/pos/transaction/{id}", posHandler.GetTransaction)
+		r.Post("/pos/transaction/{id}/cancel", posHandler.CancelTransaction)
+		r.Get("/pos/transaction/{id}/payment-request", posHandler.GetPaymentRequest)
+		r.Get("/pos/transaction/{id}/receipt", receiptHandler.GetReceipt)
 		r.Get("/pos/transactions", posHandler.ListTransactions)
 		r.HandleFunc("/pos/ws/transaction", posHandler.TransactionWS)
+		r.Post("/pos/sse/ticket", posHandler.CreateStreamTicket)
+		r.HandleFunc("/pos/ws/events", posHandler.EventsWS)
+		r.Post("/pos/displays/pair", posHandler.PairDisplay)
+		r.Get("/pos/displays", posHandler.ListDisplays)
+		r.Post("/pos/displays/{id}/show", posHandler.ShowOnDisplay)
+		r.Post("/pos/displays/{id}/delete", posHandler.DeleteDisplay)
+
+		// Catalog routes, read by POS and vendor tokens and managed by vendors
+		r.Get("/pos/catalog", catalogHandler.GetCatalog)
+		r.Get("/vendor/catalog", catalogHandler.GetCatalog)
+		r.Get("/catalog/products/{id}/image", catalogHandler.GetProductImage)
+		r.Post("/vendor/catalog/categories", catalogHandler.CreateCategory)
+		r.Post("/vendor/catalog/categories/{id}/update", catalogHandler.UpdateCategory)
+		r.Post("/vendor/catalog/categories/{id}/delete", catalogHandler.DeleteCategory)
+		r.Post("/vendor/catalog/products", catalogHandler.CreateProduct)
+		r.Post("/vendor/catalog/products/{id}/update", catalogHandler.UpdateProduct)
+		r.Post("/vendor/catalog/products/{id}/delete", catalogHandler.DeleteProduct)
+
+		// Inventory routes
+		r.Get("/vendor/inventory", inventoryHandler.ListStock)
+		r.Post("/vendor/inventory", inventoryHandler.CreateStockItem)
+		r.Post("/vendor/inventory/{id}/update", inventoryHandler.UpdateStockItem)
+		r.Post("/vendor/inventory/{id}/adjust", inventoryHandler.AdjustStock)
+		r.Post("/vendor/inventory/{id}/delete", inventoryHandler.DeleteStockItem)
+		r.Get("/vendor/inventory/{id}/adjustments", inventoryHandler.ListAdjustments)
+
+		// Promotion routes
+		r.Get("/vendor/promotions", promotionHandler.ListPromotions)
+		r.Post("/vendor/promotions", promotionHandler.CreatePromotion)
+		r.Post("/vendor/promotions/{id}/update", promotionHandler.UpdatePromotion)
+		r.Post("/vendor/promotions/{id}/delete", promotionHandler.DeletePromotion)
+
+		// Exchange rate routes
+		r.Get("/rates/{currency}", ratesHandler.GetRate)
 	})
 
 	return r
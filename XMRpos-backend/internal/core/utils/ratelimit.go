@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter counts events per key in fixed windows. It lives in memory, so with several
+// instances each one applies the limit on its own.
+type RateLimiter struct {
+	limit     int
+	window    time.Duration
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow counts an event for key and reports whether it is within the limit
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.current(key, time.Now())
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// Exhausted reports whether key has used up its window, without counting an event
+func (l *RateLimiter) Exhausted(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current(key, time.Now()).count >= l.limit
+}
+
+func (l *RateLimiter) current(key string, now time.Time) *rateWindow {
+	// Drop finished windows now and then so keys seen once do not pile up
+	if now.Sub(l.lastSweep) > l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	return w
+}
+
+// ClientIP is the address of the client, as set by the RealIP middleware when behind a proxy
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
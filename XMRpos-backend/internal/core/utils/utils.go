@@ -2,6 +2,8 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
 )
@@ -13,3 +15,18 @@ func GetClaimFromContext(ctx context.Context, key models.ClaimsContextKey) (valu
 	}
 	return value, true
 }
+
+// FormatXMR renders atomic units as a decimal XMR amount without trailing zeros, e.g. 1500000000000 -> "1.5"
+func FormatXMR(atomic int64) string {
+	sign := ""
+	if atomic < 0 {
+		sign = "-"
+		atomic = -atomic
+	}
+	integer := atomic / 1_000_000_000_000
+	fraction := atomic % 1_000_000_000_000
+	if fraction == 0 {
+		return fmt.Sprintf("%s%d", sign, integer)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, integer, strings.TrimRight(fmt.Sprintf("%012d", fraction), "0"))
+}
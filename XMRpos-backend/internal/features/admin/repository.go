@@ -38,7 +38,8 @@ func (r *adminRepository) ListVendorsWithBalances(ctx context.Context) ([]Vendor
 	var results []VendorSummary
 	err := r.db.WithContext(ctx).
 		Model(&models.Vendor{}).
-		Select("vendors.id AS id, vendors.name AS name, vendors.monero_subaddress AS monero_subaddress, COALESCE(SUM(CASE WHEN transactions.confirmed = ? AND transactions.transferred = ? THEN transactions.amount ELSE 0 END), 0) AS balance", true, false).
+		Select("vendors.id AS id, vendors.name AS name, vendors.monero_subaddress AS monero_subaddress, COALESCE(SUM(CASE WHEN transactions.confirmed = ? AND transactions.transferred = ? AND transactions.review_required = ? AND transactions.transfer_id IS NULL THEN transactions.amount ELSE 0 END), 0) - "+
+			"COALESCE((SELECT SUM(refunds.amount) FROM refunds WHERE refunds.vendor_id = vendors.id AND refunds.from_excess = ? AND refunds.transfer_id IS NULL AND (refunds.completed = ? OR refunds.attempts < ?) AND refunds.deleted_at IS NULL), 0) AS balance", true, false, false, false, true, models.MaxRefundAttempts).
 		Joins("LEFT JOIN transactions ON transactions.vendor_id = vendors.id").
 		Group("vendors.id, vendors.name, vendors.monero_subaddress").
 		Order("vendors.id ASC").
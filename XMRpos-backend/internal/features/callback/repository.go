@@ -2,19 +2,39 @@ package callback
 
 import (
 	"context"
+	"time"
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/inventory"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/promotion"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/vendor"
 	"gorm.io/gorm"
 )
 
 type CallbackRepository interface {
 	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
 	FindUnconfirmedTransactions(ctx context.Context) ([]*models.Transaction, error)
-	UpdateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
+	UpdateTransaction(ctx context.Context, transaction *models.Transaction, flagForReview bool) (*models.Transaction, error)
 	UpdateSubTransaction(ctx context.Context, subTx *models.SubTransaction) (*models.SubTransaction, error)
 	CreateSubTransaction(ctx context.Context, subTx *models.SubTransaction) (*models.SubTransaction, error)
+	CreateReorgEvents(ctx context.Context, events []*models.ReorgEvent) error
+	FindExpiredPendingTransactions(ctx context.Context, now time.Time) ([]*models.Transaction, error)
+	MarkTransactionExpired(ctx context.Context, id uint) (bool, error)
 }
 
+// Statuses a transaction expires from once its payment window has passed
+var expirableStatuses = []string{models.TransactionStatusPending, models.TransactionStatusUnderpaid}
+
+// A reorganized payment that has not come back after this long (about 720 blocks) is given up
+const unrecoveredReorgTimeout = 24 * time.Hour
+
+// A confirmed sale not paid out yet is checked for reorgs this long after it was created, well past the
+// highest final threshold of 720 blocks. One that waits in a transfer is checked until the transfer is sent.
+const reorgWatchWindow = 48 * time.Hour
+
+// A transaction waiting for a reorganized payment only expires once the last reorg is older than unrecoveredReorgTimeout
+const reorgSettledCondition = "(reorg_pending = ? OR NOT EXISTS (SELECT 1 FROM reorg_events WHERE reorg_events.transaction_id = transactions.id AND reorg_events.deleted_at IS NULL AND reorg_events.created_at > ?))"
+
 type callbackRepository struct {
 	db *gorm.DB
 }
@@ -38,33 +58,110 @@ func (r *callbackRepository) FindUnconfirmedTransactions(ctx context.Context) ([
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	// Expired and cancelled transactions are only polled once a (late) payment has been recorded for them.
+	// Confirmed transactions not paid out yet are checked again, so a reorg keeps them out of the payout.
 	var transactions []*models.Transaction
 	if err := r.db.WithContext(ctx).
 		Preload("SubTransactions").
-		Where("confirmed = ?", false).
+		Where("confirmed = ? OR (transferred = ? AND (transfer_id IS NOT NULL OR created_at > ?))", false, false, time.Now().Add(-reorgWatchWindow)).
+		Where("status IN ? OR EXISTS (SELECT 1 FROM sub_transactions WHERE sub_transactions.transaction_id = transactions.id AND sub_transactions.deleted_at IS NULL)",
+			[]string{models.TransactionStatusPending, models.TransactionStatusPaid, models.TransactionStatusUnderpaid, models.TransactionStatusOverpaid}).
+		Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// Transactions still waiting for (the rest of) their payment past expires_at, underpaid ones included
+func (r *callbackRepository) FindExpiredPendingTransactions(ctx context.Context, now time.Time) ([]*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var transactions []*models.Transaction
+	if err := r.db.WithContext(ctx).
+		Where("status IN ? AND expires_at IS NOT NULL AND expires_at < ?", expirableStatuses, now).
+		Where(reorgSettledCondition, false, now.Add(-unrecoveredReorgTimeout)).
 		Find(&transactions).Error; err != nil {
 		return nil, err
 	}
 	return transactions, nil
 }
 
-// Update only the main transaction fields
-func (r *callbackRepository) UpdateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error) {
+// Mark a transaction as expired if it is still pending or underpaid, releasing the stock and discount code use it held.
+// A payment that was reorganized out may be mined again, so such a transaction is left pending until
+// unrecoveredReorgTimeout, then it expires and is taken off a pending transfer.
+func (r *callbackRepository) MarkTransactionExpired(ctx context.Context, id uint) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	expired := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Transaction{}).
+			Where("id = ? AND status IN ?", id, expirableStatuses).
+			Where(reorgSettledCondition, false, time.Now().Add(-unrecoveredReorgTimeout)).
+			Updates(map[string]interface{}{"status": models.TransactionStatusExpired, "reorg_pending": false})
+		if result.Error != nil {
+			return result.Error
+		}
+		expired = result.RowsAffected > 0
+		if !expired {
+			return nil
+		}
+		if err := promotion.Release(tx, id); err != nil {
+			return err
+		}
+		if err := inventory.Release(tx, id); err != nil {
+			return err
+		}
+		// An unrecovered reorg no longer holds back the payout it was part of
+		_, err := vendor.DetachFromTransfer(tx, id)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return expired, nil
+}
+
+// Update only the payment tracking fields of the main transaction.
+// They are selected explicitly so that zero values (e.g. a cleared shortfall) are written too.
+// Once the transaction is accepted its reserved stock is deducted in the same database transaction.
+// The review flag is only written when raised, so a release by the vendor in the meantime is kept.
+func (r *callbackRepository) UpdateTransaction(ctx context.Context, transaction *models.Transaction, flagForReview bool) (*models.Transaction, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if err := r.db.WithContext(ctx).Model(&models.Transaction{}).Where("id = ?", transaction.ID).Updates(transaction).Error; err != nil {
+	columns := []string{"accepted", "confirmed", "status", "late_payment", "amount_received", "amount_shortfall", "amount_excess", "double_spend_seen", "reorg_pending"}
+	if flagForReview {
+		columns = append(columns, "review_required")
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Transaction{}).
+			Where("id = ?", transaction.ID).
+			Select(columns).
+			Updates(transaction).Error; err != nil {
+			return err
+		}
+		if !transaction.Accepted {
+			return nil
+		}
+		return inventory.Deduct(tx, transaction.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return transaction, nil
 }
 
-// Update an existing subtransaction (by ID)
+// Update an existing subtransaction (by ID).
+// The columns are selected so that a reorg can bring the height and confirmations back to zero.
 func (r *callbackRepository) UpdateSubTransaction(ctx context.Context, subTx *models.SubTransaction) (*models.SubTransaction, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).Where("id = ?", subTx.ID).Updates(subTx).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).Where("id = ?", subTx.ID).
+		Select("amount", "confirmations", "double_spend_seen", "fee", "height", "timestamp", "unlock_time", "locked", "orphaned").
+		Updates(subTx).Error; err != nil {
 		return nil, err
 	}
 	return subTx, nil
@@ -80,3 +177,13 @@ func (r *callbackRepository) CreateSubTransaction(ctx context.Context, subTx *mo
 	}
 	return subTx, nil
 }
+
+func (r *callbackRepository) CreateReorgEvents(ctx context.Context, events []*models.ReorgEvent) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&events).Error
+}
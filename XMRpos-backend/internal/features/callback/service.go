@@ -2,6 +2,7 @@ package callback
 
 import (
 	"context"
+	"log"
 	"sync"
 
 	"net/http"
@@ -12,26 +13,32 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	database "github.com/monerokon/xmrpos/xmrpos-backend/internal/core/database"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
+	"gorm.io/gorm"
 )
 
 type CallbackService struct {
 	repo      CallbackRepository
+	db        *gorm.DB
 	config    *config.Config
 	moneroPay *moneropay.MoneroPayAPIClient
 	mu        sync.Mutex
 }
 
-func NewCallbackService(repo CallbackRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *CallbackService {
-	return &CallbackService{repo: repo, config: cfg, moneroPay: moneroPay}
+func NewCallbackService(repo CallbackRepository, db *gorm.DB, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *CallbackService {
+	return &CallbackService{repo: repo, db: db, config: cfg, moneroPay: moneroPay}
 }
 
 func (s *CallbackService) StartConfirmationChecker(ctx context.Context, interval time.Duration) {
 	go func() {
 		runSweep := func(parent context.Context) {
 			sweepCtx, cancel := context.WithTimeout(parent, 20*time.Second)
-			s.checkUnconfirmedTransactions(sweepCtx)
+			// With several instances one of them checks, the others skip the sweep
+			if _, err := database.RunExclusive(sweepCtx, s.db, database.LockConfirmationChecker, s.checkUnconfirmedTransactions); err != nil {
+				log.Printf("Confirmation checker lock unavailable: %v", err)
+			}
 			cancel()
 		}
 
@@ -54,6 +61,8 @@ func (s *CallbackService) checkUnconfirmedTransactions(ctx context.Context) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.expireStaleTransactions(ctx)
+
 	unconfirmed, err := s.repo.FindUnconfirmedTransactions(ctx)
 	if err != nil {
 		return
@@ -73,20 +82,52 @@ func (s *CallbackService) checkUnconfirmedTransactions(ctx context.Context) {
 		}
 
 		if moneroStatus != nil {
-			_ = s.processTransaction(ctx, tx.ID, *moneroStatus)
+			_ = s.processTransaction(ctx, tx.ID, *moneroStatus, true)
+		}
+	}
+}
+
+// Expire pending and underpaid transactions whose payment window has passed
+func (s *CallbackService) expireStaleTransactions(ctx context.Context) {
+	stale, err := s.repo.FindExpiredPendingTransactions(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to fetch expired transactions: %v", err)
+		return
+	}
+
+	for _, tx := range stale {
+		expired, err := s.repo.MarkTransactionExpired(ctx, tx.ID)
+		if err != nil {
+			log.Printf("Failed to expire transaction %d: %v", tx.ID, err)
+			continue
+		}
+		if !expired {
+			continue
 		}
+		previousStatus := tx.Status
+		tx.Status = models.TransactionStatusExpired
+		tx.ReorgPending = false
+		go pos.NotifyTransactionEvent(tx, pos.TransactionEventTypes(previousStatus, tx.Confirmed, tx)...)
 	}
 }
 
-func (s *CallbackService) processTransaction(ctx context.Context, transactionID uint, transactionToProcess moneropay.ReceiveAddressResponse) *models.HTTPError {
+// processTransaction applies the payments MoneroPay reports for a transaction. fullListing is set when
+// they are all of its payments, so that one missing from them has vanished.
+func (s *CallbackService) processTransaction(ctx context.Context, transactionID uint, transactionToProcess moneropay.ReceiveAddressResponse, fullListing bool) *models.HTTPError {
 
 	// Get the transaction by ID
 	transaction, err := s.repo.FindTransactionByID(ctx, transactionID)
 	if err != nil {
 		return models.NewHTTPError(http.StatusNotFound, "Transaction not found")
 	}
+	previousStatus, previousConfirmed := transaction.Status, transaction.Confirmed
+	previousDoubleSpend := transaction.DoubleSpendSeen
 
+	recordedNewPayment := false
+	reported := make(map[string]bool, len(transactionToProcess.Transactions))
+	var reorgs []*models.ReorgEvent
 	for _, subTxToProcess := range transactionToProcess.Transactions {
+		reported[subTxToProcess.TxHash] = true
 		// Create or update the subtransaction
 		subTransaction := &models.SubTransaction{
 			TransactionID:   transaction.ID,
@@ -102,22 +143,27 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 		}
 
 		// See if the txHash already exists in the transaction's subtransactions
-		existing := false
+		var existing *models.SubTransaction
 		for _, subTx := range transaction.SubTransactions {
 			if subTx.TxHash == subTransaction.TxHash {
 				subTransaction.ID = subTx.ID // Ensure we set the ID for update
-				existing = true
+				existing = subTx
 				break
 			}
 		}
 
-		if !existing {
+		if existing == nil {
 			// Create new subtransaction
 			_, err := s.repo.CreateSubTransaction(ctx, subTransaction)
 			if err != nil {
 				return models.NewHTTPError(http.StatusInternalServerError, "Failed to create subtransaction: "+err.Error())
 			}
+			recordedNewPayment = true
 		} else {
+			// A payment that was in a block and is now in another one, or back in the pool, was reorganized
+			if existing.Height != 0 && existing.Height != subTransaction.Height && !existing.Orphaned {
+				reorgs = append(reorgs, newReorgEvent(existing, models.ReorgKindHeightChanged, subTransaction))
+			}
 			// Update existing subtransaction
 			_, err := s.repo.UpdateSubTransaction(ctx, subTransaction)
 			if err != nil {
@@ -126,6 +172,29 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 		}
 	}
 
+	// A callback only carries the new payment, just a full listing shows that one is gone
+	if fullListing {
+		for _, subTx := range transaction.SubTransactions {
+			if reported[subTx.TxHash] || subTx.Orphaned {
+				continue
+			}
+			// A payment dropped from the pool is left out as well, but only one that was mined holds the transaction back
+			if subTx.Height != 0 {
+				reorgs = append(reorgs, newReorgEvent(subTx, models.ReorgKindVanished, nil))
+			}
+			subTx.Orphaned = true
+			if _, err := s.repo.UpdateSubTransaction(ctx, subTx); err != nil {
+				return models.NewHTTPError(http.StatusInternalServerError, "Failed to update subtransaction: "+err.Error())
+			}
+		}
+	}
+	if err := s.repo.CreateReorgEvents(ctx, reorgs); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "Failed to record reorg: "+err.Error())
+	}
+	for _, reorg := range reorgs {
+		log.Printf("Reorg on transaction %d: payment %s %s (height %d -> %d)", reorg.TransactionID, reorg.TxHash, reorg.Kind, reorg.PreviousHeight, reorg.Height)
+	}
+
 	// Get the updated transaction with subtransactions
 	transaction, err = s.repo.FindTransactionByID(ctx, transaction.ID)
 	if err != nil {
@@ -135,6 +204,9 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 	// Calculate if transaction is accepted
 	allAccepted := true
 	for _, subTx := range transaction.SubTransactions {
+		if subTx.Orphaned {
+			continue
+		}
 		if subTx.Confirmations < transaction.RequiredConfirmations {
 			allAccepted = false
 			break
@@ -147,10 +219,13 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 
 	transaction.Accepted = allAccepted
 
-	// Calculate if the transaction is confirmed
+	// Calculate if the transaction is confirmed, at the final threshold of the vendor policy
 	allConfirmed := true
 	for _, subTx := range transaction.SubTransactions {
-		if subTx.Confirmations < 10 {
+		if subTx.Orphaned {
+			continue
+		}
+		if subTx.Confirmations < transaction.FinalConfirmations {
 			allConfirmed = false
 			break
 		}
@@ -162,17 +237,116 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 
 	transaction.Confirmed = allConfirmed
 
+	// A payment that may be replaced by a conflicting one cannot be trusted, whatever its confirmations.
+	// Acceptance is revoked while the wallet reports it, and the sale stays flagged for review after.
+	// A callback carries only the new payment, so the stored ones are checked too.
+	transaction.DoubleSpendSeen = false
+	for _, subTx := range transaction.SubTransactions {
+		if subTx.DoubleSpendSeen && !subTx.Orphaned {
+			transaction.DoubleSpendSeen = true
+			break
+		}
+	}
+	doubleSpendDetected := transaction.DoubleSpendSeen && !previousDoubleSpend
+	if transaction.DoubleSpendSeen {
+		transaction.Accepted = false
+		transaction.Confirmed = false
+	}
+	if doubleSpendDetected {
+		transaction.ReviewRequired = true
+		log.Printf("Double spend seen on transaction %d, acceptance revoked pending review", transaction.ID)
+	}
+
+	// Payouts wait for a reorganized transaction until it is confirmed again
+	if len(reorgs) > 0 {
+		transaction.ReorgPending = true
+	}
+	if transaction.Confirmed {
+		transaction.ReorgPending = false
+	}
+
+	transaction.AmountReceived = transactionToProcess.Amount.Covered.Total
+
+	switch transaction.Status {
+	case models.TransactionStatusExpired, models.TransactionStatusCancelled:
+		// Keep the final status, but flag that money arrived anyway
+		if recordedNewPayment {
+			transaction.LatePayment = true
+		}
+	default:
+		applyPaymentStatus(transaction)
+	}
+
 	// Update the transaction in the repository
-	_, err = s.repo.UpdateTransaction(ctx, transaction)
+	_, err = s.repo.UpdateTransaction(ctx, transaction, doubleSpendDetected)
 	if err != nil {
 		return models.NewHTTPError(http.StatusInternalServerError, "Failed to update transaction: "+err.Error())
 	}
 
-	go pos.NotifyTransactionUpdate(transaction.ID, transaction)
+	var alerts []string
+	if doubleSpendDetected {
+		alerts = append(alerts, pos.VendorEventTransactionDoubleSpend)
+	}
+	if len(reorgs) > 0 {
+		alerts = append(alerts, pos.VendorEventTransactionReorg)
+	}
+	eventTypes := pos.TransactionEventTypes(previousStatus, previousConfirmed, transaction)
+	if len(alerts) > 0 {
+		// Alerts replace the generic update
+		if len(eventTypes) == 1 && eventTypes[0] == pos.VendorEventTransactionUpdated {
+			eventTypes = eventTypes[:0]
+		}
+		eventTypes = append(eventTypes, alerts...)
+	}
+	go pos.NotifyTransactionEvent(transaction, eventTypes...)
 
 	return nil
 }
 
+// newReorgEvent records how a stored payment moved, current is nil when it vanished
+func newReorgEvent(stored *models.SubTransaction, kind string, current *models.SubTransaction) *models.ReorgEvent {
+	event := &models.ReorgEvent{
+		TransactionID:         stored.TransactionID,
+		SubTransactionID:      stored.ID,
+		TxHash:                stored.TxHash,
+		Kind:                  kind,
+		PreviousHeight:        stored.Height,
+		PreviousConfirmations: stored.Confirmations,
+	}
+	if current != nil {
+		event.Height = current.Height
+		event.Confirmations = current.Confirmations
+	}
+	return event
+}
+
+// Classify the received amount against the requested amount
+func applyPaymentStatus(transaction *models.Transaction) {
+	received := transaction.AmountReceived
+	shortAccepted := transaction.PaymentResolution != nil && *transaction.PaymentResolution == models.PaymentResolutionShortAccepted
+
+	switch {
+	case received == 0:
+		transaction.Status = models.TransactionStatusPending
+	case received < transaction.Amount:
+		transaction.Status = models.TransactionStatusUnderpaid
+		transaction.AmountShortfall = transaction.Amount - received
+		transaction.AmountExcess = 0
+	case received > transaction.Amount:
+		transaction.Status = models.TransactionStatusOverpaid
+		transaction.AmountExcess = received - transaction.Amount
+		if !shortAccepted {
+			transaction.AmountShortfall = 0
+		}
+	default:
+		transaction.Status = models.TransactionStatusPaid
+		transaction.AmountExcess = 0
+		if !shortAccepted {
+			transaction.AmountShortfall = 0
+		}
+	}
+}
+
 func (s *CallbackService) HandleCallback(ctx context.Context, jwtToken string, callback moneropay.CallbackResponse) (httpErr *models.HTTPError) {
 	if ctx == nil {
 		return models.NewHTTPError(http.StatusInternalServerError, "context required")
@@ -206,7 +380,7 @@ func (s *CallbackService) HandleCallback(ctx context.Context, jwtToken string, c
 		return models.NewHTTPError(http.StatusUnauthorized, "Invalid token")
 	}
 
-	httpErr = s.processTransaction(ctx, claims.TransactionID, callback.ToReceiveAddressResponse())
+	httpErr = s.processTransaction(ctx, claims.TransactionID, callback.ToReceiveAddressResponse(), false)
 	if httpErr != nil {
 		return httpErr
 	}
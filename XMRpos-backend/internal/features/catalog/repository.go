@@ -0,0 +1,277 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every column but the image itself, listings only need to know whether there is one
+var productListColumns = []string{
+	"id", "created_at", "updated_at", "deleted_at", "vendor_id", "category_id", "name", "sku", "description",
+	"price", "currency", "tax_rate", "image_content_type", "image_hash", "active", "version",
+}
+
+type CatalogRepository interface {
+	GetCatalogVersion(ctx context.Context, vendorID uint) (int64, error)
+	ListCategories(ctx context.Context, vendorID uint, sinceVersion int64) ([]*models.Category, error)
+	ListProducts(ctx context.Context, vendorID uint, sinceVersion int64) ([]*models.Product, error)
+	FindCategory(ctx context.Context, vendorID uint, id uint) (*models.Category, error)
+	FindProduct(ctx context.Context, vendorID uint, id uint) (*models.Product, error)
+	FindProductImage(ctx context.Context, vendorID uint, id uint) (*models.Product, error)
+	ProductSKUExists(ctx context.Context, vendorID uint, sku string, excludeID uint) (bool, error)
+	CreateCategory(ctx context.Context, category *models.Category) error
+	UpdateCategory(ctx context.Context, vendorID uint, id uint, updates map[string]interface{}) error
+	DeleteCategory(ctx context.Context, vendorID uint, id uint) error
+	CreateProduct(ctx context.Context, product *models.Product) error
+	UpdateProduct(ctx context.Context, vendorID uint, id uint, updates map[string]interface{}) error
+	DeleteProduct(ctx context.Context, vendorID uint, id uint) error
+}
+
+type catalogRepository struct {
+	db *gorm.DB
+}
+
+func NewCatalogRepository(db *gorm.DB) CatalogRepository {
+	return &catalogRepository{db: db}
+}
+
+// bumpVersion increments the vendor catalog version inside tx and returns the new version
+func bumpVersion(tx *gorm.DB, vendorID uint) (int64, error) {
+	var vendor models.Vendor
+	err := tx.Model(&vendor).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "catalog_version"}}}).
+		Where("id = ?", vendorID).
+		UpdateColumn("catalog_version", gorm.Expr("catalog_version + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	return vendor.CatalogVersion, nil
+}
+
+func (r *catalogRepository) GetCatalogVersion(ctx context.Context, vendorID uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var version int64
+	if err := r.db.WithContext(ctx).Model(&models.Vendor{}).
+		Where("id = ?", vendorID).
+		Select("catalog_version").
+		Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// ListCategories returns the whole catalog when sinceVersion is 0, otherwise the changes after it including deletions
+func (r *catalogRepository) ListCategories(ctx context.Context, vendorID uint, sinceVersion int64) ([]*models.Category, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID)
+	if sinceVersion > 0 {
+		query = query.Unscoped().Where("version > ?", sinceVersion)
+	}
+	var categories []*models.Category
+	if err := query.Order("sort_order ASC, id ASC").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *catalogRepository) ListProducts(ctx context.Context, vendorID uint, sinceVersion int64) ([]*models.Product, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := r.db.WithContext(ctx).Select(productListColumns).Where("vendor_id = ?", vendorID)
+	if sinceVersion > 0 {
+		query = query.Unscoped().Where("version > ?", sinceVersion)
+	}
+	var products []*models.Product
+	if err := query.Order("id ASC").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *catalogRepository) FindCategory(ctx context.Context, vendorID uint, id uint) (*models.Category, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var category models.Category
+	if err := r.db.WithContext(ctx).Where("id = ? AND vendor_id = ?", id, vendorID).First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *catalogRepository) FindProduct(ctx context.Context, vendorID uint, id uint) (*models.Product, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var product models.Product
+	if err := r.db.WithContext(ctx).
+		Select(productListColumns).
+		Where("id = ? AND vendor_id = ?", id, vendorID).
+		First(&product).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *catalogRepository) FindProductImage(ctx context.Context, vendorID uint, id uint) (*models.Product, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var product models.Product
+	if err := r.db.WithContext(ctx).
+		Select("id", "image", "image_content_type", "image_hash").
+		Where("id = ? AND vendor_id = ?", id, vendorID).
+		First(&product).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *catalogRepository) ProductSKUExists(ctx context.Context, vendorID uint, sku string, excludeID uint) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Product{}).
+		Where("vendor_id = ? AND sku = ? AND id <> ?", vendorID, sku, excludeID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *catalogRepository) CreateCategory(ctx context.Context, category *models.Category) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, category.VendorID)
+		if err != nil {
+			return err
+		}
+		category.Version = version
+		return tx.Create(category).Error
+	})
+}
+
+func (r *catalogRepository) UpdateCategory(ctx context.Context, vendorID uint, id uint, updates map[string]interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, vendorID)
+		if err != nil {
+			return err
+		}
+		updates["version"] = version
+		result := tx.Model(&models.Category{}).Where("id = ? AND vendor_id = ?", id, vendorID).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteCategory soft deletes the category and moves its products out of it, so devices see both changes
+func (r *catalogRepository) DeleteCategory(ctx context.Context, vendorID uint, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, vendorID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Product{}).
+			Where("category_id = ? AND vendor_id = ?", id, vendorID).
+			Updates(map[string]interface{}{"category_id": nil, "version": version}).Error; err != nil {
+			return err
+		}
+		// The tombstone carries the new version so incremental syncs pick up the deletion
+		if err := tx.Model(&models.Category{}).
+			Where("id = ? AND vendor_id = ?", id, vendorID).
+			Update("version", version).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND vendor_id = ?", id, vendorID).Delete(&models.Category{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *catalogRepository) CreateProduct(ctx context.Context, product *models.Product) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, product.VendorID)
+		if err != nil {
+			return err
+		}
+		product.Version = version
+		return tx.Create(product).Error
+	})
+}
+
+func (r *catalogRepository) UpdateProduct(ctx context.Context, vendorID uint, id uint, updates map[string]interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, vendorID)
+		if err != nil {
+			return err
+		}
+		updates["version"] = version
+		result := tx.Model(&models.Product{}).Where("id = ? AND vendor_id = ?", id, vendorID).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *catalogRepository) DeleteProduct(ctx context.Context, vendorID uint, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		version, err := bumpVersion(tx, vendorID)
+		if err != nil {
+			return err
+		}
+		// The tombstone carries the new version so incremental syncs pick up the deletion
+		if err := tx.Model(&models.Product{}).
+			Where("id = ? AND vendor_id = ?", id, vendorID).
+			Updates(map[string]interface{}{"version": version, "image": nil, "image_content_type": nil, "image_hash": nil}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND vendor_id = ?", id, vendorID).Delete(&models.Product{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
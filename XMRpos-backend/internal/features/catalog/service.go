@@ -0,0 +1,461 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	maxNameLength        = 255
+	maxDescriptionLength = 4096
+	maxImageBytes        = 512 * 1024
+	maxImagePixels       = 2048
+)
+
+var currencyRegex = regexp.MustCompile("^[A-Z]{3}$")
+
+type CatalogService struct {
+	repo CatalogRepository
+}
+
+func NewCatalogService(repo CatalogRepository) *CatalogService {
+	return &CatalogService{repo: repo}
+}
+
+type CategorySummary struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	SortOrder int64     `json:"sort_order"`
+	Active    bool      `json:"active"`
+	Deleted   bool      `json:"deleted"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ProductSummary struct {
+	ID          uint      `json:"id"`
+	CategoryID  *uint     `json:"category_id"`
+	Name        string    `json:"name"`
+	SKU         *string   `json:"sku"`
+	Description *string   `json:"description"`
+	Price       float64   `json:"price"`
+	Currency    string    `json:"currency"`
+	TaxRate     *float64  `json:"tax_rate"`
+	ImageHash   *string   `json:"image_hash"` // Changes whenever the image does, nil without an image
+	Active      bool      `json:"active"`
+	Deleted     bool      `json:"deleted"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Catalog is either the whole catalog or, for an incremental sync, what changed since the client's version
+type Catalog struct {
+	Version     int64             `json:"version"` // Pass back as ?since= for the next sync
+	Incremental bool              `json:"incremental"`
+	Categories  []CategorySummary `json:"categories"`
+	Products    []ProductSummary  `json:"products"`
+}
+
+func toCategorySummary(category *models.Category) CategorySummary {
+	return CategorySummary{
+		ID:        category.ID,
+		Name:      category.Name,
+		SortOrder: category.SortOrder,
+		Active:    category.Active,
+		Deleted:   category.DeletedAt.Valid,
+		UpdatedAt: category.UpdatedAt,
+	}
+}
+
+func toProductSummary(product *models.Product) ProductSummary {
+	return ProductSummary{
+		ID:          product.ID,
+		CategoryID:  product.CategoryID,
+		Name:        product.Name,
+		SKU:         product.SKU,
+		Description: product.Description,
+		Price:       product.Price,
+		Currency:    product.Currency,
+		TaxRate:     product.TaxRate,
+		ImageHash:   product.ImageHash,
+		Active:      product.Active,
+		Deleted:     product.DeletedAt.Valid,
+		UpdatedAt:   product.UpdatedAt,
+	}
+}
+
+// CatalogETag is the entity tag of a vendor's catalog at a version
+func CatalogETag(vendorID uint, version int64) string {
+	return fmt.Sprintf(`"catalog-%d-%d"`, vendorID, version)
+}
+
+func (s *CatalogService) GetVersion(ctx context.Context, vendorID uint) (int64, *models.HTTPError) {
+	version, err := s.repo.GetCatalogVersion(ctx, vendorID)
+	if err != nil {
+		return 0, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	return version, nil
+}
+
+// GetCatalog returns the whole catalog, or only the changes after sinceVersion (deletions included) when it is set
+func (s *CatalogService) GetCatalog(ctx context.Context, vendorID uint, sinceVersion int64) (*Catalog, *models.HTTPError) {
+	version, err := s.repo.GetCatalogVersion(ctx, vendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	// A client ahead of the server (e.g. after a restore) starts over
+	if sinceVersion > version {
+		sinceVersion = 0
+	}
+
+	categories, err := s.repo.ListCategories(ctx, vendorID, sinceVersion)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	products, err := s.repo.ListProducts(ctx, vendorID, sinceVersion)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	catalog := &Catalog{
+		Version:     version,
+		Incremental: sinceVersion > 0,
+		Categories:  make([]CategorySummary, 0, len(categories)),
+		Products:    make([]ProductSummary, 0, len(products)),
+	}
+	for _, category := range categories {
+		// Changes committed after the version was read show up again in the next sync
+		if category.Version > version {
+			continue
+		}
+		catalog.Categories = append(catalog.Categories, toCategorySummary(category))
+	}
+	for _, product := range products {
+		if product.Version > version {
+			continue
+		}
+		catalog.Products = append(catalog.Products, toProductSummary(product))
+	}
+	return catalog, nil
+}
+
+type CategoryParams struct {
+	Name      *string `json:"name"`
+	SortOrder *int64  `json:"sort_order"`
+	Active    *bool   `json:"active"`
+}
+
+func (s *CatalogService) CreateCategory(ctx context.Context, vendorID uint, params CategoryParams) (*CategorySummary, *models.HTTPError) {
+	if params.Name == nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	updates, httpErr := categoryUpdates(params)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	category := &models.Category{
+		VendorID: vendorID,
+		Name:     updates["name"].(string),
+		Active:   true,
+	}
+	if params.SortOrder != nil {
+		category.SortOrder = *params.SortOrder
+	}
+	if params.Active != nil {
+		category.Active = *params.Active
+	}
+
+	if err := s.repo.CreateCategory(ctx, category); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	// Create skips false booleans in favour of the column default
+	if !category.Active {
+		if err := s.repo.UpdateCategory(ctx, vendorID, category.ID, map[string]interface{}{"active": false}); err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+	}
+
+	return s.getCategory(ctx, vendorID, category.ID)
+}
+
+func (s *CatalogService) UpdateCategory(ctx context.Context, vendorID uint, id uint, params CategoryParams) (*CategorySummary, *models.HTTPError) {
+	updates, httpErr := categoryUpdates(params)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if len(updates) > 0 {
+		if err := s.repo.UpdateCategory(ctx, vendorID, id, updates); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, models.NewHTTPError(http.StatusNotFound, "category not found")
+			}
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+	}
+	return s.getCategory(ctx, vendorID, id)
+}
+
+func (s *CatalogService) DeleteCategory(ctx context.Context, vendorID uint, id uint) *models.HTTPError {
+	if err := s.repo.DeleteCategory(ctx, vendorID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.NewHTTPError(http.StatusNotFound, "category not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	return nil
+}
+
+func (s *CatalogService) getCategory(ctx context.Context, vendorID uint, id uint) (*CategorySummary, *models.HTTPError) {
+	category, err := s.repo.FindCategory(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "category not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summary := toCategorySummary(category)
+	return &summary, nil
+}
+
+func categoryUpdates(params CategoryParams) (map[string]interface{}, *models.HTTPError) {
+	updates := map[string]interface{}{}
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" || len(name) > maxNameLength {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "name must be between 1 and 255 characters")
+		}
+		updates["name"] = name
+	}
+	if params.SortOrder != nil {
+		updates["sort_order"] = *params.SortOrder
+	}
+	if params.Active != nil {
+		updates["active"] = *params.Active
+	}
+	return updates, nil
+}
+
+// ProductParams holds the product fields to set, nil fields are left untouched and empty strings clear optional ones
+type ProductParams struct {
+	CategoryID  *uint    `json:"category_id"`
+	Name        *string  `json:"name"`
+	SKU         *string  `json:"sku"`
+	Description *string  `json:"description"`
+	Price       *float64 `json:"price"`
+	Currency    *string  `json:"currency"`
+	TaxRate     *float64 `json:"tax_rate"`
+	Image       *string  `json:"image"` // Base64 encoded PNG or JPEG
+	Active      *bool    `json:"active"`
+}
+
+func (s *CatalogService) CreateProduct(ctx context.Context, vendorID uint, params ProductParams) (*ProductSummary, *models.HTTPError) {
+	if params.Name == nil || params.Price == nil || params.Currency == nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "name, price and currency are required")
+	}
+	updates, httpErr := s.productUpdates(ctx, vendorID, 0, params)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	product := &models.Product{
+		VendorID: vendorID,
+		Name:     updates["name"].(string),
+		Price:    updates["price"].(float64),
+		Currency: updates["currency"].(string),
+		Active:   true,
+	}
+	if err := s.repo.CreateProduct(ctx, product); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	// The optional fields go through the same update path as edits
+	delete(updates, "name")
+	delete(updates, "price")
+	delete(updates, "currency")
+	if len(updates) > 0 {
+		if err := s.repo.UpdateProduct(ctx, vendorID, product.ID, updates); err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+	}
+
+	return s.getProduct(ctx, vendorID, product.ID)
+}
+
+func (s *CatalogService) UpdateProduct(ctx context.Context, vendorID uint, id uint, params ProductParams) (*ProductSummary, *models.HTTPError) {
+	if _, httpErr := s.getProduct(ctx, vendorID, id); httpErr != nil {
+		return nil, httpErr
+	}
+	updates, httpErr := s.productUpdates(ctx, vendorID, id, params)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if len(updates) > 0 {
+		if err := s.repo.UpdateProduct(ctx, vendorID, id, updates); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, models.NewHTTPError(http.StatusNotFound, "product not found")
+			}
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+	}
+	return s.getProduct(ctx, vendorID, id)
+}
+
+func (s *CatalogService) DeleteProduct(ctx context.Context, vendorID uint, id uint) *models.HTTPError {
+	if err := s.repo.DeleteProduct(ctx, vendorID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.NewHTTPError(http.StatusNotFound, "product not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	return nil
+}
+
+// GetProductImage returns the image bytes, content type and hash of a product
+func (s *CatalogService) GetProductImage(ctx context.Context, vendorID uint, id uint) ([]byte, string, string, *models.HTTPError) {
+	product, err := s.repo.FindProductImage(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", "", models.NewHTTPError(http.StatusNotFound, "product not found")
+		}
+		return nil, "", "", models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	if len(product.Image) == 0 || product.ImageContentType == nil || product.ImageHash == nil {
+		return nil, "", "", models.NewHTTPError(http.StatusNotFound, "product has no image")
+	}
+	return product.Image, *product.ImageContentType, *product.ImageHash, nil
+}
+
+func (s *CatalogService) getProduct(ctx context.Context, vendorID uint, id uint) (*ProductSummary, *models.HTTPError) {
+	product, err := s.repo.FindProduct(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "product not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summary := toProductSummary(product)
+	return &summary, nil
+}
+
+func (s *CatalogService) productUpdates(ctx context.Context, vendorID uint, productID uint, params ProductParams) (map[string]interface{}, *models.HTTPError) {
+	updates := map[string]interface{}{}
+
+	if params.CategoryID != nil {
+		if *params.CategoryID == 0 {
+			updates["category_id"] = nil
+		} else {
+			if _, httpErr := s.getCategory(ctx, vendorID, *params.CategoryID); httpErr != nil {
+				return nil, httpErr
+			}
+			updates["category_id"] = *params.CategoryID
+		}
+	}
+
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" || len(name) > maxNameLength {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "name must be between 1 and 255 characters")
+		}
+		updates["name"] = name
+	}
+
+	if params.SKU != nil {
+		sku := strings.TrimSpace(*params.SKU)
+		switch {
+		case sku == "":
+			updates["sku"] = nil
+		case len(sku) > maxNameLength:
+			return nil, models.NewHTTPError(http.StatusBadRequest, "sku must be at most 255 characters")
+		default:
+			exists, err := s.repo.ProductSKUExists(ctx, vendorID, sku, productID)
+			if err != nil {
+				return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+			}
+			if exists {
+				return nil, models.NewHTTPError(http.StatusConflict, "another product already uses this sku")
+			}
+			updates["sku"] = sku
+		}
+	}
+
+	if params.Description != nil {
+		description := strings.TrimSpace(*params.Description)
+		if len(description) > maxDescriptionLength {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "description must be at most 4096 characters")
+		}
+		if description == "" {
+			updates["description"] = nil
+		} else {
+			updates["description"] = description
+		}
+	}
+
+	if params.Price != nil {
+		if *params.Price < 0 || math.IsInf(*params.Price, 0) || math.IsNaN(*params.Price) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "price must not be negative")
+		}
+		updates["price"] = *params.Price
+	}
+
+	if params.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*params.Currency))
+		if !currencyRegex.MatchString(currency) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "currency must be a three letter code")
+		}
+		updates["currency"] = currency
+	}
+
+	if params.TaxRate != nil {
+		if *params.TaxRate < 0 || *params.TaxRate > 100 {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "tax_rate must be between 0 and 100")
+		}
+		updates["tax_rate"] = *params.TaxRate
+	}
+
+	if params.Image != nil {
+		if *params.Image == "" {
+			updates["image"] = nil
+			updates["image_content_type"] = nil
+			updates["image_hash"] = nil
+		} else {
+			data, err := base64.StdEncoding.DecodeString(*params.Image)
+			if err != nil {
+				return nil, models.NewHTTPError(http.StatusBadRequest, "image must be base64 encoded")
+			}
+			if len(data) > maxImageBytes {
+				return nil, models.NewHTTPError(http.StatusBadRequest, "image must be at most 512 KiB")
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil || (format != "png" && format != "jpeg") {
+				return nil, models.NewHTTPError(http.StatusBadRequest, "image must be a PNG or JPEG image")
+			}
+			if cfg.Width > maxImagePixels || cfg.Height > maxImagePixels {
+				return nil, models.NewHTTPError(http.StatusBadRequest, "image must be at most 2048x2048 pixels")
+			}
+			hash := sha256.Sum256(data)
+			updates["image"] = data
+			updates["image_content_type"] = "image/" + format
+			updates["image_hash"] = hex.EncodeToString(hash[:])
+		}
+	}
+
+	if params.Active != nil {
+		updates["active"] = *params.Active
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,244 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+type InventoryHandler struct {
+	service *InventoryService
+}
+
+func NewInventoryHandler(service *InventoryService) *InventoryHandler {
+	return &InventoryHandler{service: service}
+}
+
+// vendorIDFromRequest returns the vendor ID of a vendor token
+func vendorIDFromRequest(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
+	if !ok || role != "vendor" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	vendorID, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
+	if !ok {
+		http.Error(w, "Unauthorized: vendorID not found", http.StatusUnauthorized)
+		return 0, false
+	}
+	return *(vendorID.(*uint)), true
+}
+
+// ListStock serves ?low=true to list only the SKUs at or below their low stock threshold
+func (h *InventoryHandler) ListStock(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	lowOnly := false
+	if value := r.URL.Query().Get("low"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid low", http.StatusBadRequest)
+			return
+		}
+		lowOnly = parsed
+	}
+
+	items, httpErr := h.service.ListStock(ctx, vendorID, lowOnly)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := struct {
+		Items []StockItemSummary `json:"items"`
+	}{Items: items}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *InventoryHandler) CreateStockItem(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req StockItemParams
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	item, httpErr := h.service.CreateStockItem(ctx, vendorID, req)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(item)
+	io.Copy(io.Discard, r.Body)
+}
+
+type updateStockItemRequest struct {
+	LowStockThreshold *int64 `json:"low_stock_threshold"`
+}
+
+func (h *InventoryHandler) UpdateStockItem(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid stock item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req updateStockItemRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	item, httpErr := h.service.SetLowStockThreshold(ctx, vendorID, uint(itemID), req.LowStockThreshold)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(item)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *InventoryHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid stock item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req AdjustmentParams
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	adjustment, httpErr := h.service.AdjustStock(ctx, vendorID, uint(itemID), req)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(adjustment)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *InventoryHandler) DeleteStockItem(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid stock item ID", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if httpErr := h.service.DeleteStockItem(ctx, vendorID, uint(itemID)); httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *InventoryHandler) ListAdjustments(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid stock item ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	vendorID, ok := vendorIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	adjustments, httpErr := h.service.ListAdjustments(ctx, vendorID, uint(itemID), limit)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := struct {
+		Adjustments []StockAdjustmentSummary `json:"adjustments"`
+	}{Adjustments: adjustments}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
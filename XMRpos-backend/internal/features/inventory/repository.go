@@ -0,0 +1,172 @@
+package inventory
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InventoryRepository interface {
+	ListStockItems(ctx context.Context, vendorID uint, lowOnly bool) ([]*models.StockItem, error)
+	FindStockItem(ctx context.Context, vendorID uint, id uint) (*models.StockItem, error)
+	StockItemSKUExists(ctx context.Context, vendorID uint, sku string) (bool, error)
+	CreateStockItem(ctx context.Context, item *models.StockItem) error
+	UpdateLowStockThreshold(ctx context.Context, vendorID uint, id uint, threshold *int64) error
+	AdjustStock(ctx context.Context, vendorID uint, id uint, delta int64, reason string, note *string) (*models.StockAdjustment, error)
+	DeleteStockItem(ctx context.Context, vendorID uint, id uint) (bool, error)
+	ListAdjustments(ctx context.Context, vendorID uint, stockItemID uint, limit int) ([]*models.StockAdjustment, error)
+}
+
+type inventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewInventoryRepository(db *gorm.DB) InventoryRepository {
+	return &inventoryRepository{db: db}
+}
+
+func (r *inventoryRepository) ListStockItems(ctx context.Context, vendorID uint, lowOnly bool) ([]*models.StockItem, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID)
+	if lowOnly {
+		query = query.Where("low_stock_threshold IS NOT NULL AND quantity - reserved <= low_stock_threshold")
+	}
+	var items []*models.StockItem
+	if err := query.Order("sku ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *inventoryRepository) FindStockItem(ctx context.Context, vendorID uint, id uint) (*models.StockItem, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var item models.StockItem
+	if err := r.db.WithContext(ctx).Where("id = ? AND vendor_id = ?", id, vendorID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *inventoryRepository) StockItemSKUExists(ctx context.Context, vendorID uint, sku string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.StockItem{}).
+		Where("vendor_id = ? AND sku = ?", vendorID, sku).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateStockItem stores the item and logs its opening quantity as a restock
+func (r *inventoryRepository) CreateStockItem(ctx context.Context, item *models.StockItem) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if item.Quantity == 0 {
+			return nil
+		}
+		return tx.Create(&models.StockAdjustment{
+			VendorID:      item.VendorID,
+			StockItemID:   item.ID,
+			SKU:           item.SKU,
+			Delta:         item.Quantity,
+			Reason:        models.StockAdjustmentReasonRestock,
+			QuantityAfter: item.Quantity,
+		}).Error
+	})
+}
+
+func (r *inventoryRepository) UpdateLowStockThreshold(ctx context.Context, vendorID uint, id uint, threshold *int64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Model(&models.StockItem{}).
+		Where("id = ? AND vendor_id = ?", id, vendorID).
+		Update("low_stock_threshold", threshold)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AdjustStock changes the quantity on hand and logs the change, it returns nil when the quantity would drop below the reserved units
+func (r *inventoryRepository) AdjustStock(ctx context.Context, vendorID uint, id uint, delta int64, reason string, note *string) (*models.StockAdjustment, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var adjustment *models.StockAdjustment
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var item models.StockItem
+		result := tx.Model(&item).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "sku"}, {Name: "quantity"}}}).
+			Where("id = ? AND vendor_id = ? AND quantity + ? >= reserved", id, vendorID, delta).
+			UpdateColumn("quantity", gorm.Expr("quantity + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		adjustment = &models.StockAdjustment{
+			VendorID:      vendorID,
+			StockItemID:   id,
+			SKU:           item.SKU,
+			Delta:         delta,
+			Reason:        reason,
+			Note:          note,
+			QuantityAfter: item.Quantity,
+		}
+		return tx.Create(adjustment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// DeleteStockItem stops tracking a SKU unless units of it are still reserved, reports whether it was deleted
+func (r *inventoryRepository) DeleteStockItem(ctx context.Context, vendorID uint, id uint) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Hard delete so the SKU can be tracked again later
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("id = ? AND vendor_id = ? AND reserved = 0", id, vendorID).
+		Delete(&models.StockItem{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *inventoryRepository) ListAdjustments(ctx context.Context, vendorID uint, stockItemID uint, limit int) ([]*models.StockAdjustment, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var adjustments []*models.StockAdjustment
+	if err := r.db.WithContext(ctx).
+		Where("vendor_id = ? AND stock_item_id = ?", vendorID, stockItemID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&adjustments).Error; err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
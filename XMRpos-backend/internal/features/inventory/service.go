@@ -0,0 +1,233 @@
+package inventory
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	maxSKULength        = 64
+	maxNoteLength       = 1024
+	defaultAdjustments  = 50
+	maxAdjustmentsLimit = 500
+)
+
+type InventoryService struct {
+	repo InventoryRepository
+}
+
+func NewInventoryService(repo InventoryRepository) *InventoryService {
+	return &InventoryService{repo: repo}
+}
+
+type StockItemSummary struct {
+	ID                uint      `json:"id"`
+	SKU               string    `json:"sku"`
+	Quantity          int64     `json:"quantity"`  // On hand
+	Reserved          int64     `json:"reserved"`  // Held by unpaid transactions
+	Available         int64     `json:"available"` // Quantity - Reserved, what new sales can take
+	LowStockThreshold *int64    `json:"low_stock_threshold"`
+	LowStock          bool      `json:"low_stock"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type StockAdjustmentSummary struct {
+	ID            uint      `json:"id"`
+	SKU           string    `json:"sku"`
+	Delta         int64     `json:"delta"`
+	Reason        string    `json:"reason"`
+	Note          *string   `json:"note"`
+	TransactionID *uint     `json:"transaction_id"`
+	QuantityAfter int64     `json:"quantity_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func toStockItemSummary(item *models.StockItem) StockItemSummary {
+	available := item.Quantity - item.Reserved
+	return StockItemSummary{
+		ID:                item.ID,
+		SKU:               item.SKU,
+		Quantity:          item.Quantity,
+		Reserved:          item.Reserved,
+		Available:         available,
+		LowStockThreshold: item.LowStockThreshold,
+		LowStock:          item.LowStockThreshold != nil && available <= *item.LowStockThreshold,
+		UpdatedAt:         item.UpdatedAt,
+	}
+}
+
+func toStockAdjustmentSummary(adjustment *models.StockAdjustment) StockAdjustmentSummary {
+	return StockAdjustmentSummary{
+		ID:            adjustment.ID,
+		SKU:           adjustment.SKU,
+		Delta:         adjustment.Delta,
+		Reason:        adjustment.Reason,
+		Note:          adjustment.Note,
+		TransactionID: adjustment.TransactionID,
+		QuantityAfter: adjustment.QuantityAfter,
+		CreatedAt:     adjustment.CreatedAt,
+	}
+}
+
+// ListStock returns the tracked SKUs of a vendor, lowOnly keeps those at or below their threshold
+func (s *InventoryService) ListStock(ctx context.Context, vendorID uint, lowOnly bool) ([]StockItemSummary, *models.HTTPError) {
+	items, err := s.repo.ListStockItems(ctx, vendorID, lowOnly)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summaries := make([]StockItemSummary, 0, len(items))
+	for _, item := range items {
+		summaries = append(summaries, toStockItemSummary(item))
+	}
+	return summaries, nil
+}
+
+type StockItemParams struct {
+	SKU               string `json:"sku"`
+	Quantity          int64  `json:"quantity"`
+	LowStockThreshold *int64 `json:"low_stock_threshold"`
+}
+
+// CreateStockItem starts tracking a SKU, sales of SKUs that are not tracked never run out
+func (s *InventoryService) CreateStockItem(ctx context.Context, vendorID uint, params StockItemParams) (*StockItemSummary, *models.HTTPError) {
+	sku := strings.TrimSpace(params.SKU)
+	if sku == "" || len(sku) > maxSKULength {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "sku must be between 1 and 64 characters")
+	}
+	if params.Quantity < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "quantity must not be negative")
+	}
+	if params.LowStockThreshold != nil && *params.LowStockThreshold < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "low_stock_threshold must not be negative")
+	}
+
+	exists, err := s.repo.StockItemSKUExists(ctx, vendorID, sku)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	if exists {
+		return nil, models.NewHTTPError(http.StatusConflict, "sku is already tracked")
+	}
+
+	item := &models.StockItem{
+		VendorID:          vendorID,
+		SKU:               sku,
+		Quantity:          params.Quantity,
+		LowStockThreshold: params.LowStockThreshold,
+	}
+	if err := s.repo.CreateStockItem(ctx, item); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	summary := toStockItemSummary(item)
+	return &summary, nil
+}
+
+// SetLowStockThreshold changes the threshold of a stock item, nil turns the low stock flag off
+func (s *InventoryService) SetLowStockThreshold(ctx context.Context, vendorID uint, id uint, threshold *int64) (*StockItemSummary, *models.HTTPError) {
+	if threshold != nil && *threshold < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "low_stock_threshold must not be negative")
+	}
+	if err := s.repo.UpdateLowStockThreshold(ctx, vendorID, id, threshold); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "stock item not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	return s.getStockItem(ctx, vendorID, id)
+}
+
+type AdjustmentParams struct {
+	Delta  int64   `json:"delta"`
+	Reason string  `json:"reason"`
+	Note   *string `json:"note"`
+}
+
+// AdjustStock records a manual stock change. Sales are deducted automatically and cannot be entered here.
+func (s *InventoryService) AdjustStock(ctx context.Context, vendorID uint, id uint, params AdjustmentParams) (*StockAdjustmentSummary, *models.HTTPError) {
+	if params.Delta == 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "delta must not be zero")
+	}
+	switch params.Reason {
+	case models.StockAdjustmentReasonRestock, models.StockAdjustmentReasonCorrection, models.StockAdjustmentReasonLoss:
+	default:
+		return nil, models.NewHTTPError(http.StatusBadRequest, "reason must be one of restock, correction, loss")
+	}
+	var note *string
+	if params.Note != nil && strings.TrimSpace(*params.Note) != "" {
+		trimmed := strings.TrimSpace(*params.Note)
+		if len(trimmed) > maxNoteLength {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "note must be at most 1024 characters")
+		}
+		note = &trimmed
+	}
+
+	if _, httpErr := s.getStockItem(ctx, vendorID, id); httpErr != nil {
+		return nil, httpErr
+	}
+
+	adjustment, err := s.repo.AdjustStock(ctx, vendorID, id, params.Delta, params.Reason, note)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	if adjustment == nil {
+		return nil, models.NewHTTPError(http.StatusConflict, "quantity cannot drop below the reserved units")
+	}
+
+	summary := toStockAdjustmentSummary(adjustment)
+	return &summary, nil
+}
+
+func (s *InventoryService) DeleteStockItem(ctx context.Context, vendorID uint, id uint) *models.HTTPError {
+	if _, httpErr := s.getStockItem(ctx, vendorID, id); httpErr != nil {
+		return httpErr
+	}
+	deleted, err := s.repo.DeleteStockItem(ctx, vendorID, id)
+	if err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	if !deleted {
+		return models.NewHTTPError(http.StatusConflict, "stock item has units reserved by unpaid transactions")
+	}
+	return nil
+}
+
+// ListAdjustments returns the most recent stock changes of an item, newest first
+func (s *InventoryService) ListAdjustments(ctx context.Context, vendorID uint, id uint, limit int) ([]StockAdjustmentSummary, *models.HTTPError) {
+	if limit <= 0 {
+		limit = defaultAdjustments
+	}
+	if limit > maxAdjustmentsLimit {
+		limit = maxAdjustmentsLimit
+	}
+	if _, httpErr := s.getStockItem(ctx, vendorID, id); httpErr != nil {
+		return nil, httpErr
+	}
+
+	adjustments, err := s.repo.ListAdjustments(ctx, vendorID, id, limit)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summaries := make([]StockAdjustmentSummary, 0, len(adjustments))
+	for _, adjustment := range adjustments {
+		summaries = append(summaries, toStockAdjustmentSummary(adjustment))
+	}
+	return summaries, nil
+}
+
+func (s *InventoryService) getStockItem(ctx context.Context, vendorID uint, id uint) (*StockItemSummary, *models.HTTPError) {
+	item, err := s.repo.FindStockItem(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "stock item not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summary := toStockItemSummary(item)
+	return &summary, nil
+}
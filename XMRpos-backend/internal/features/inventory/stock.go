@@ -0,0 +1,161 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The helpers below run inside the caller's database transaction, so stock moves together with the sale
+
+// InsufficientStockError is returned by Reserve when a tracked SKU has fewer units available than the sale needs
+type InsufficientStockError struct {
+	SKU       string
+	Available int64
+	Requested int64
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for SKU %s: %d available, %d requested", e.SKU, e.Available, e.Requested)
+}
+
+// QuantitiesBySKU sums the quantities of line items that carry a SKU
+func QuantitiesBySKU(items []*models.LineItem) map[string]int64 {
+	quantities := make(map[string]int64)
+	for _, item := range items {
+		if item.SKU == nil || *item.SKU == "" {
+			continue
+		}
+		quantities[*item.SKU] += item.Quantity
+	}
+	return quantities
+}
+
+// Reserve holds the quantities for a transaction. SKUs without a stock item are not tracked and are skipped.
+func Reserve(tx *gorm.DB, vendorID uint, transactionID uint, quantities map[string]int64) error {
+	// Lock in a stable order so concurrent sales of the same SKUs cannot deadlock
+	skus := make([]string, 0, len(quantities))
+	for sku := range quantities {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+
+	for _, sku := range skus {
+		quantity := quantities[sku]
+		var item models.StockItem
+		err := tx.Where("vendor_id = ? AND sku = ?", vendorID, sku).First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.StockItem{}).
+			Where("id = ? AND quantity - reserved >= ?", item.ID, quantity).
+			UpdateColumn("reserved", gorm.Expr("reserved + ?", quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Re-read for the error message, the row may have changed since the first read
+			if err := tx.First(&item, item.ID).Error; err != nil {
+				return err
+			}
+			return &InsufficientStockError{SKU: sku, Available: item.Quantity - item.Reserved, Requested: quantity}
+		}
+
+		reservation := &models.StockReservation{
+			VendorID:      vendorID,
+			TransactionID: transactionID,
+			StockItemID:   item.ID,
+			SKU:           sku,
+			Quantity:      quantity,
+			Status:        models.StockReservationStatusReserved,
+		}
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deduct takes the reserved units of a transaction off the stock and records them as sales.
+// A late payment can accept a transaction whose reservation was already released, those units are taken off too.
+func Deduct(tx *gorm.DB, transactionID uint) error {
+	return settle(tx, transactionID, models.StockReservationStatusDeducted)
+}
+
+// Release returns the reserved units of a transaction that will not be paid
+func Release(tx *gorm.DB, transactionID uint) error {
+	return settle(tx, transactionID, models.StockReservationStatusReleased)
+}
+
+// settle moves every open reservation of the transaction to status, each reservation is settled at most once
+func settle(tx *gorm.DB, transactionID uint, status string) error {
+	from := []string{models.StockReservationStatusReserved}
+	if status == models.StockReservationStatusDeducted {
+		from = append(from, models.StockReservationStatusReleased)
+	}
+	var reservations []*models.StockReservation
+	if err := tx.Where("transaction_id = ? AND status IN ?", transactionID, from).
+		Order("sku ASC").
+		Find(&reservations).Error; err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		result := tx.Model(&models.StockReservation{}).
+			Where("id = ? AND status = ?", reservation.ID, reservation.Status).
+			Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Settled concurrently
+			continue
+		}
+
+		updates := map[string]interface{}{}
+		if reservation.Status == models.StockReservationStatusReserved {
+			updates["reserved"] = gorm.Expr("reserved - ?", reservation.Quantity)
+		}
+		if status == models.StockReservationStatusDeducted {
+			updates["quantity"] = gorm.Expr("quantity - ?", reservation.Quantity)
+		}
+		var item models.StockItem
+		result = tx.Model(&item).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "quantity"}}}).
+			Where("id = ?", reservation.StockItemID).
+			UpdateColumns(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// The SKU is no longer tracked
+			continue
+		}
+
+		if status != models.StockReservationStatusDeducted {
+			continue
+		}
+		transactionID := reservation.TransactionID
+		adjustment := &models.StockAdjustment{
+			VendorID:      reservation.VendorID,
+			StockItemID:   reservation.StockItemID,
+			SKU:           reservation.SKU,
+			Delta:         -reservation.Quantity,
+			Reason:        models.StockAdjustmentReasonSale,
+			TransactionID: &transactionID,
+			QuantityAfter: item.Quantity,
+		}
+		if err := tx.Create(adjustment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
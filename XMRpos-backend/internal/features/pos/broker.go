@@ -0,0 +1,119 @@
+package pos
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// BrokerMessage is a transaction update or vendor event on its way to every backend instance
+type BrokerMessage struct {
+	VendorID      uint           `json:"vendor_id"`
+	TransactionID uint           `json:"transaction_id,omitempty"`
+	EventTypes    []string       `json:"event_types"`
+	Time          time.Time      `json:"time"`
+	Transfer      *TransferEvent `json:"transfer,omitempty"`
+	DisplayIDs    []uint         `json:"display_ids,omitempty"` // customer displays to reload
+	Origin        string         `json:"origin,omitempty"`      // instance that published it, which already delivered it
+	// Only passed within the process, other instances load the transaction by TransactionID
+	Transaction *models.Transaction `json:"-"`
+}
+
+// Broker fans messages out to every backend instance, each one delivers them to its own WebSocket, SSE and display clients
+type Broker interface {
+	Publish(ctx context.Context, message *BrokerMessage) error
+}
+
+// localBroker serves a single instance by delivering right away
+type localBroker struct {
+	repo PosRepository
+}
+
+func NewLocalBroker(repo PosRepository) Broker {
+	return &localBroker{repo: repo}
+}
+
+func (b *localBroker) Publish(ctx context.Context, message *BrokerMessage) error {
+	if b.repo != nil {
+		if err := loadTransaction(ctx, b.repo, message); err != nil {
+			return err
+		}
+	}
+	deliver(message)
+	return nil
+}
+
+var broker Broker = &localBroker{}
+
+// SetBroker replaces the in-process broker, call it before serving requests
+func SetBroker(b Broker) {
+	broker = b
+}
+
+// loadTransaction replaces the transaction of a message with the stored one, so subscribers see the
+// same state and sequence a reconnect would load. Notifications are sent after the update.
+func loadTransaction(ctx context.Context, repo PosRepository, message *BrokerMessage) error {
+	if message.TransactionID == 0 {
+		return nil
+	}
+	transaction, err := repo.FindTransactionByID(ctx, message.TransactionID)
+	if err != nil {
+		return err
+	}
+	message.Transaction = transaction
+	return nil
+}
+
+// deliver hands a message to the clients connected to this instance
+func deliver(message *BrokerMessage) {
+	if message.Transaction != nil {
+		hub.publish(message.Transaction)
+	}
+	for _, eventType := range message.EventTypes {
+		deliverVendorEvent(message.VendorID, VendorEvent{
+			Type:        eventType,
+			Time:        message.Time,
+			Transaction: message.Transaction,
+			Transfer:    message.Transfer,
+		})
+	}
+	for _, sessionID := range message.DisplayIDs {
+		displays.notify(sessionID)
+	}
+}
+
+func publish(message *BrokerMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := broker.Publish(ctx, message); err != nil {
+		// Better to reach the clients of this instance than nobody
+		log.Printf("broker: publish failed, delivering locally only: %v", err)
+		deliver(message)
+	}
+}
+
+// NotifyTransactionEvent pushes the transaction to its own subscribers and each event type to the vendor feed
+func NotifyTransactionEvent(transaction *models.Transaction, eventTypes ...string) {
+	publish(&BrokerMessage{
+		VendorID:      transaction.VendorID,
+		TransactionID: transaction.ID,
+		EventTypes:    eventTypes,
+		Time:          time.Now(),
+		Transaction:   transaction,
+	})
+}
+
+// NotifyVendorEvent sends an event that is not about a single transaction to the vendor feed
+func NotifyVendorEvent(vendorID uint, event VendorEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	publish(&BrokerMessage{
+		VendorID:   vendorID,
+		EventTypes: []string{event.Type},
+		Time:       event.Time,
+		Transfer:   event.Transfer,
+	})
+}
@@ -0,0 +1,68 @@
+package pos
+
+import (
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+const (
+	maxCartItems        = 200
+	maxLineItemQuantity = 100000
+	maxLineItemName     = 255
+	cartTotalTolerance  = 0.005 // Half a cent, fiat amounts are rounded to cents
+)
+
+type LineItemParams struct {
+	Name      string   `json:"name"`
+	SKU       *string  `json:"sku"`
+	Quantity  int64    `json:"quantity"`
+	UnitPrice float64  `json:"unit_price"`
+	TaxRate   *float64 `json:"tax_rate"`
+}
+
+// buildLineItems validates the cart and returns its line items with the cart total in fiat
+func buildLineItems(items []LineItemParams) ([]*models.LineItem, float64, *models.HTTPError) {
+	if len(items) > maxCartItems {
+		return nil, 0, models.NewHTTPError(http.StatusBadRequest, "Cart must have at most 200 items")
+	}
+
+	lineItems := make([]*models.LineItem, 0, len(items))
+	var total float64
+	for _, item := range items {
+		name := strings.TrimSpace(item.Name)
+		if name == "" || len(name) > maxLineItemName {
+			return nil, 0, models.NewHTTPError(http.StatusBadRequest, "Item name must be between 1 and 255 characters")
+		}
+		if item.Quantity < 1 || item.Quantity > maxLineItemQuantity {
+			return nil, 0, models.NewHTTPError(http.StatusBadRequest, "Item quantity must be between 1 and 100000")
+		}
+		if item.UnitPrice < 0 || math.IsInf(item.UnitPrice, 0) || math.IsNaN(item.UnitPrice) {
+			return nil, 0, models.NewHTTPError(http.StatusBadRequest, "Item unit_price must not be negative")
+		}
+		if item.TaxRate != nil && (*item.TaxRate < 0 || *item.TaxRate > 100) {
+			return nil, 0, models.NewHTTPError(http.StatusBadRequest, "Item tax_rate must be between 0 and 100")
+		}
+
+		var sku *string
+		if item.SKU != nil && strings.TrimSpace(*item.SKU) != "" {
+			trimmed := strings.TrimSpace(*item.SKU)
+			sku = &trimmed
+		}
+
+		lineTotal := roundFiat(float64(item.Quantity) * item.UnitPrice)
+		total += lineTotal
+		lineItems = append(lineItems, &models.LineItem{
+			Name:      name,
+			SKU:       sku,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			TaxRate:   item.TaxRate,
+			Total:     lineTotal,
+		})
+	}
+
+	return lineItems, roundFiat(total), nil
+}
@@ -0,0 +1,50 @@
+package pos
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/rates"
+)
+
+// confirmationPolicy applies the policy of the vendor to a sale of amount atomic units worth amountInCurrency
+// in currency, returning the confirmations to accept it and to settle it. The device has no say in them:
+// without tiers a sale waits for the final threshold, with tiers the first one the sale stays below decides
+// and a sale above all of them waits for the final threshold.
+func (s *PosService) confirmationPolicy(ctx context.Context, vendor *models.Vendor, amount int64, currency string, amountInCurrency float64) (required int64, final int64) {
+	final = vendor.FinalConfirmations
+	if final <= 0 {
+		final = models.DefaultFinalConfirmations
+	}
+	return s.requiredConfirmations(ctx, vendor, amount, currency, amountInCurrency, final), final
+}
+
+func (s *PosService) requiredConfirmations(ctx context.Context, vendor *models.Vendor, amount int64, currency string, amountInCurrency float64, final int64) int64 {
+	if len(vendor.ConfirmationTiers) == 0 {
+		return final
+	}
+
+	// The tiers share one currency, a sale in another one is valued at the current rate
+	tierCurrency := vendor.ConfirmationTiers[0].Currency
+	value := amountInCurrency
+	if !strings.EqualFold(currency, tierCurrency) {
+		if s.rates == nil || !s.rates.Enabled() {
+			return final
+		}
+		rate, err := s.rates.GetRate(ctx, tierCurrency)
+		if err != nil {
+			log.Printf("Exchange rate for %s unavailable, applying the final confirmation threshold: %v", tierCurrency, err)
+			return final
+		}
+		value = float64(amount) / rates.AtomicUnitsPerXMR * rate.Rate
+	}
+
+	for _, tier := range vendor.ConfirmationTiers {
+		if value < tier.Below {
+			return min(tier.Confirmations, final)
+		}
+	}
+	return final
+}
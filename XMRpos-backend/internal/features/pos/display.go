@@ -0,0 +1,435 @@
+package pos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	displayPairingLifetime   = 10 * time.Minute
+	displayPairingAttempts   = 5
+	displayPairingCodeLength = 8
+	// Displays waiting to be paired at once, so that guessing a code stays hopeless
+	maxDisplayPairings = 1000
+	// DisplayEventVersion is the schema of the events on the display stream
+	DisplayEventVersion = 1
+)
+
+// States on the display stream beyond the stored ones, a payment turns into the outcome of its transaction
+const (
+	DisplayStatePairing   = "pairing"   // not paired yet, showing pairing_code
+	DisplayStatePaid      = "paid"      // payment received
+	DisplayStateExpired   = "expired"   // the transaction expired unpaid
+	DisplayStateCancelled = "cancelled" // the transaction was cancelled
+)
+
+// DisplayEvent is everything a customer display needs to draw the screen, each event replaces the previous one
+type DisplayEvent struct {
+	Version     int             `json:"version"`
+	State       string          `json:"state"`
+	PairingCode *string         `json:"pairing_code,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"` // of the pairing code
+	Merchant    string          `json:"merchant,omitempty"`
+	Header      *string         `json:"header,omitempty"`
+	Logo        []byte          `json:"logo,omitempty"` // Base64 encoded PNG or JPEG, only when idle
+	Cart        *DisplayCart    `json:"cart,omitempty"`
+	Payment     *DisplayPayment `json:"payment,omitempty"`
+}
+
+type DisplayCartItem struct {
+	Name      string  `json:"name"`
+	Quantity  int64   `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Total     float64 `json:"total"`
+}
+
+type DisplayCart struct {
+	Items    []DisplayCartItem `json:"items"`
+	Currency string            `json:"currency"`
+	Total    float64           `json:"total"`
+}
+
+type DisplayPayment struct {
+	TransactionID         uint       `json:"transaction_id"`
+	Status                string     `json:"status"`
+	URI                   string     `json:"uri,omitempty"`         // monero: URI, while payment is due
+	QRCodeSVG             string     `json:"qr_code_svg,omitempty"` // of the URI
+	Amount                int64      `json:"amount"`                // Atomic units due
+	AmountReceived        int64      `json:"amount_received"`
+	Currency              string     `json:"currency"`
+	AmountInCurrency      float64    `json:"amount_in_currency"`
+	TipAmountInCurrency   float64    `json:"tip_amount_in_currency"`
+	ExchangeRate          *float64   `json:"exchange_rate"`
+	Accepted              bool       `json:"accepted"`
+	Confirmed             bool       `json:"confirmed"`
+	Confirmations         int64      `json:"confirmations"`
+	RequiredConfirmations int64      `json:"required_confirmations"`
+	ExpiresAt             *time.Time `json:"expires_at"`
+}
+
+type DisplaySession struct {
+	ID            uint      `json:"id"`
+	Name          *string   `json:"name"`
+	State         string    `json:"state"`
+	TransactionID *uint     `json:"transaction_id"`
+	PairedAt      time.Time `json:"paired_at"`
+}
+
+type DisplayPairing struct {
+	Token       string    `json:"token"`
+	PairingCode string    `json:"pairing_code"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type PairDisplayParams struct {
+	PairingCode string  `json:"pairing_code"`
+	Name        *string `json:"name"`
+}
+
+// ShowOnDisplayParams picks what a display shows: idle, a cart (items or a bare amount) or a transaction
+type ShowOnDisplayParams struct {
+	State            string           `json:"state"`
+	Items            []LineItemParams `json:"items"`
+	AmountInCurrency *float64         `json:"amount_in_currency"`
+	Currency         *string          `json:"currency"`
+	TransactionID    *uint            `json:"transaction_id"`
+}
+
+// Pairing is open to anyone who can reach the server, so it is rate limited
+var (
+	displaySessionLimiter = utils.NewRateLimiter(10, time.Minute)    // new displays per client address
+	displayPairLimiter    = utils.NewRateLimiter(20, time.Minute)    // pair requests per client address and per POS
+	displayPairFailures   = utils.NewRateLimiter(10, 15*time.Minute) // wrong codes per POS before it is locked out
+)
+
+// displayHub wakes the streams of a display when what it shows changes
+type displayHub struct {
+	signals map[uint]map[chan struct{}]struct{} // display session ID -> streams
+	mu      sync.Mutex
+}
+
+var displays = displayHub{
+	signals: make(map[uint]map[chan struct{}]struct{}),
+}
+
+func (h *displayHub) subscribe(sessionID uint) chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.signals[sessionID] == nil {
+		h.signals[sessionID] = make(map[chan struct{}]struct{})
+	}
+	h.signals[sessionID][ch] = struct{}{}
+	return ch
+}
+
+func (h *displayHub) unsubscribe(sessionID uint, ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.signals[sessionID], ch)
+	if len(h.signals[sessionID]) == 0 {
+		delete(h.signals, sessionID)
+	}
+}
+
+func (h *displayHub) notify(sessionID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.signals[sessionID] {
+		// A pending signal already makes the stream reload
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sessionIDs lists the displays streaming from this instance
+func (h *displayHub) sessionIDs() []uint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]uint, 0, len(h.signals))
+	for id := range h.signals {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// notifyDisplays wakes the streams of the displays on every instance
+func notifyDisplays(sessionIDs ...uint) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	publish(&BrokerMessage{DisplayIDs: sessionIDs, Time: time.Now()})
+}
+
+func displaySessionSummary(session *models.DisplaySession) DisplaySession {
+	summary := DisplaySession{
+		ID:            session.ID,
+		Name:          session.Name,
+		State:         session.State,
+		TransactionID: session.TransactionID,
+	}
+	if session.PairedAt != nil {
+		summary.PairedAt = *session.PairedAt
+	}
+	return summary
+}
+
+// CreateDisplayPairing starts a display session, the display shows the code until a POS enters it
+func (s *PosService) CreateDisplayPairing(ctx context.Context) (*DisplayPairing, *models.HTTPError) {
+	now := time.Now()
+	if err := s.repo.DeleteExpiredDisplayPairings(ctx, now); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	pending, err := s.repo.CountDisplayPairings(ctx, now)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	if pending >= maxDisplayPairings {
+		return nil, models.NewHTTPError(http.StatusServiceUnavailable, "Too many displays waiting to be paired, please retry later")
+	}
+
+	token, err := gonanoid.New(32)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to generate display token: "+err.Error())
+	}
+	expiresAt := now.Add(displayPairingLifetime)
+
+	for attempt := 0; attempt < displayPairingAttempts; attempt++ {
+		code, err := gonanoid.Generate("0123456789", displayPairingCodeLength)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to generate pairing code: "+err.Error())
+		}
+		session := &models.DisplaySession{
+			Token:            token,
+			PairingCode:      &code,
+			PairingExpiresAt: &expiresAt,
+			State:            models.DisplayStateIdle,
+		}
+		created, err := s.repo.CreateDisplaySession(ctx, session)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+		if created {
+			return &DisplayPairing{Token: token, PairingCode: code, ExpiresAt: expiresAt}, nil
+		}
+	}
+	return nil, models.NewHTTPError(http.StatusServiceUnavailable, "No pairing code available, please retry")
+}
+
+func (s *PosService) PairDisplay(ctx context.Context, vendorID uint, posID uint, params PairDisplayParams) (*DisplaySession, *models.HTTPError) {
+	code := strings.TrimSpace(params.PairingCode)
+	if code == "" {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "pairing_code is required")
+	}
+	failureKey := fmt.Sprintf("pos:%d", posID)
+	if displayPairFailures.Exhausted(failureKey) {
+		return nil, models.NewHTTPError(http.StatusTooManyRequests, "Too many wrong pairing codes, please wait before trying again")
+	}
+	name := params.Name
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if len(trimmed) > 100 {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "name must be at most 100 characters")
+		}
+		name = &trimmed
+		if trimmed == "" {
+			name = nil
+		}
+	}
+
+	session, err := s.repo.PairDisplaySession(ctx, code, vendorID, posID, name, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		displayPairFailures.Allow(failureKey)
+		return nil, models.NewHTTPError(http.StatusNotFound, "pairing code not found or expired")
+	}
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	go notifyDisplays(session.ID)
+	summary := displaySessionSummary(session)
+	return &summary, nil
+}
+
+func (s *PosService) ListDisplays(ctx context.Context, posID uint) ([]DisplaySession, *models.HTTPError) {
+	sessions, err := s.repo.ListDisplaySessions(ctx, posID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summaries := make([]DisplaySession, 0, len(sessions))
+	for _, session := range sessions {
+		summaries = append(summaries, displaySessionSummary(session))
+	}
+	return summaries, nil
+}
+
+// ShowOnDisplay changes what a display of the POS shows
+func (s *PosService) ShowOnDisplay(ctx context.Context, vendorID uint, posID uint, sessionID uint, params ShowOnDisplayParams) (*DisplaySession, *models.HTTPError) {
+	updates := map[string]interface{}{"state": params.State, "cart": nil, "transaction_id": nil}
+	switch params.State {
+	case models.DisplayStateIdle:
+	case models.DisplayStateCart:
+		if params.Currency == nil || strings.TrimSpace(*params.Currency) == "" {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "currency is required for a cart")
+		}
+		lineItems, total, httpErr := buildLineItems(params.Items)
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		cart := DisplayCart{Items: make([]DisplayCartItem, 0, len(lineItems)), Currency: strings.ToUpper(strings.TrimSpace(*params.Currency)), Total: total}
+		for _, item := range lineItems {
+			cart.Items = append(cart.Items, DisplayCartItem{Name: item.Name, Quantity: item.Quantity, UnitPrice: item.UnitPrice, Total: item.Total})
+		}
+		if len(lineItems) == 0 {
+			if params.AmountInCurrency == nil || *params.AmountInCurrency < 0 || math.IsInf(*params.AmountInCurrency, 0) || math.IsNaN(*params.AmountInCurrency) {
+				return nil, models.NewHTTPError(http.StatusBadRequest, "items or amount_in_currency is required for a cart")
+			}
+			cart.Total = roundFiat(*params.AmountInCurrency)
+		}
+		encoded, err := json.Marshal(cart)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to encode cart: "+err.Error())
+		}
+		updates["cart"] = string(encoded)
+	case models.DisplayStatePayment:
+		if params.TransactionID == nil {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "transaction_id is required for a payment")
+		}
+		if _, httpErr := s.GetTransaction(ctx, *params.TransactionID, vendorID, posID); httpErr != nil {
+			return nil, httpErr
+		}
+		updates["transaction_id"] = *params.TransactionID
+	default:
+		return nil, models.NewHTTPError(http.StatusBadRequest, "state must be idle, cart or payment")
+	}
+
+	if err := s.repo.UpdateDisplaySession(ctx, posID, sessionID, updates); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusNotFound, "display not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	session, err := s.repo.FindDisplaySession(ctx, posID, sessionID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	go notifyDisplays(sessionID)
+	summary := displaySessionSummary(session)
+	return &summary, nil
+}
+
+func (s *PosService) DeleteDisplay(ctx context.Context, posID uint, sessionID uint) *models.HTTPError {
+	if err := s.repo.DeleteDisplaySession(ctx, posID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NewHTTPError(http.StatusNotFound, "display not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	// The stream finds the session gone and ends
+	go notifyDisplays(sessionID)
+	return nil
+}
+
+// showTransactionOnDisplays puts a new transaction of the POS on its displays
+func (s *PosService) showTransactionOnDisplays(ctx context.Context, posID uint, transactionID uint) {
+	ids, err := s.repo.ShowTransactionOnDisplays(ctx, posID, transactionID)
+	if err != nil {
+		log.Printf("Failed to show transaction %d on displays of POS %d: %v", transactionID, posID, err)
+		return
+	}
+	go notifyDisplays(ids...)
+}
+
+// renderDisplay builds the screen of a display session, transaction is its current transaction when known
+func (s *PosService) renderDisplay(ctx context.Context, session *models.DisplaySession, transaction *models.Transaction) (*DisplayEvent, error) {
+	event := &DisplayEvent{Version: DisplayEventVersion, State: session.State}
+	if session.PairedAt == nil || session.VendorID == nil {
+		event.State = DisplayStatePairing
+		event.PairingCode = session.PairingCode
+		event.ExpiresAt = session.PairingExpiresAt
+		return event, nil
+	}
+
+	vendor, err := s.repo.FindVendorByID(ctx, *session.VendorID)
+	if err != nil {
+		return nil, err
+	}
+	event.Merchant = vendor.Name
+	if vendor.ReceiptCompanyName != nil {
+		event.Merchant = *vendor.ReceiptCompanyName
+	}
+
+	switch session.State {
+	case models.DisplayStateCart:
+		if session.Cart != nil {
+			var cart DisplayCart
+			if err := json.Unmarshal([]byte(*session.Cart), &cart); err != nil {
+				return nil, err
+			}
+			event.Cart = &cart
+		}
+	case models.DisplayStatePayment:
+		if transaction == nil {
+			break
+		}
+		event.Payment = &DisplayPayment{
+			TransactionID:         transaction.ID,
+			Status:                transaction.Status,
+			Amount:                transaction.Amount,
+			AmountReceived:        transaction.AmountReceived,
+			Currency:              transaction.Currency,
+			AmountInCurrency:      transaction.AmountInCurrency,
+			TipAmountInCurrency:   transaction.TipAmountInCurrency,
+			ExchangeRate:          transaction.ExchangeRate,
+			Accepted:              transaction.Accepted,
+			Confirmed:             transaction.Confirmed,
+			RequiredConfirmations: transaction.RequiredConfirmations,
+			ExpiresAt:             transaction.ExpiresAt,
+		}
+		counted := false
+		for _, sub := range transaction.SubTransactions {
+			if !sub.Orphaned && (!counted || sub.Confirmations < event.Payment.Confirmations) {
+				event.Payment.Confirmations = sub.Confirmations
+				counted = true
+			}
+		}
+		switch transaction.Status {
+		case models.TransactionStatusPending, models.TransactionStatusUnderpaid:
+			// The QR code is only shown while something is still due
+			if paymentRequest, httpErr := s.buildPaymentRequest(ctx, transaction); httpErr == nil {
+				event.Payment.URI = paymentRequest.URI
+				event.Payment.QRCodeSVG = paymentRequest.QRCodeSVG
+				event.Payment.Amount = paymentRequest.Amount
+			}
+		case models.TransactionStatusExpired:
+			event.State = DisplayStateExpired
+		case models.TransactionStatusCancelled:
+			event.State = DisplayStateCancelled
+		default:
+			// A double-spent payment is not shown as received
+			if !transaction.DoubleSpendSeen {
+				event.State = DisplayStatePaid
+			}
+		}
+	default:
+		event.Header = vendor.ReceiptHeader
+		event.Logo = vendor.ReceiptLogo
+	}
+	return event, nil
+}
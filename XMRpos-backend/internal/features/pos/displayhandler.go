@@ -0,0 +1,349 @@
+package pos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+	"gorm.io/gorm"
+)
+
+// errDisplayGone ends a display stream whose session was deleted or never paired in time
+var errDisplayGone = errors.New("display session gone")
+
+// CreateDisplaySession is called by the display itself, it shows the pairing code and keeps the token to stream with
+func (h *PosHandler) CreateDisplaySession(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	if !displaySessionLimiter.Allow(utils.ClientIP(r)) {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	pairing, httpErr := h.service.CreateDisplayPairing(ctx)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(pairing)
+}
+
+// posIDs reads the vendor and POS of a POS token
+func posIDs(w http.ResponseWriter, r *http.Request) (vendorID uint, posID uint, ok bool) {
+	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
+	if !ok || role != "pos" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil || posIDPtr == nil {
+		http.Error(w, "Vendor ID and POS ID are required", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return *vendorIDPtr, *posIDPtr, true
+}
+
+func (h *PosHandler) PairDisplay(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB cap
+
+	vendorID, posID, ok := posIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if !displayPairLimiter.Allow("ip:"+utils.ClientIP(r)) || !displayPairLimiter.Allow(fmt.Sprintf("pos:%d", posID)) {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req PairDisplayParams
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	display, httpErr := h.service.PairDisplay(ctx, vendorID, posID, req)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(display)
+
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *PosHandler) ListDisplays(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	_, posID, ok := posIDs(w, r)
+	if !ok {
+		return
+	}
+
+	displays, httpErr := h.service.ListDisplays(ctx, posID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(displays)
+}
+
+func (h *PosHandler) ShowOnDisplay(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB cap
+
+	displayID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid display ID", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, posID, ok := posIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req ShowOnDisplayParams
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	display, httpErr := h.service.ShowOnDisplay(ctx, vendorID, posID, uint(displayID), req)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(display)
+
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *PosHandler) DeleteDisplay(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	displayID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid display ID", http.StatusBadRequest)
+		return
+	}
+
+	_, posID, ok := posIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if httpErr := h.service.DeleteDisplay(ctx, posID, uint(displayID)); httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// displayStream follows one display session and the transaction it shows
+type displayStream struct {
+	handler *PosHandler
+	token   string
+	session *models.DisplaySession
+	sub     *subscription // of the transaction on screen, nil when none
+}
+
+// load reads the session and renders its screen, resubscribing when the transaction on screen changed
+func (s *displayStream) load(ctx context.Context) (*DisplayEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	session, err := s.handler.service.repo.FindDisplaySessionByToken(ctx, s.token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errDisplayGone
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.PairedAt == nil && (session.PairingExpiresAt == nil || !session.PairingExpiresAt.After(time.Now())) {
+		return nil, errDisplayGone
+	}
+	s.session = session
+
+	var transactionID uint
+	if session.State == models.DisplayStatePayment && session.TransactionID != nil {
+		transactionID = *session.TransactionID
+	}
+	if s.sub != nil && s.sub.transactionID != transactionID {
+		hub.unsubscribe(s.sub)
+		s.sub = nil
+	}
+
+	var transaction *models.Transaction
+	if transactionID != 0 {
+		// Subscribed before loading, so no change falls in between
+		if s.sub == nil {
+			s.sub = hub.subscribe(transactionID)
+		}
+		transaction, err = s.handler.service.repo.FindTransactionByID(ctx, transactionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return s.handler.service.renderDisplay(ctx, session, transaction)
+}
+
+func (s *displayStream) close() {
+	if s.sub != nil {
+		hub.unsubscribe(s.sub)
+	}
+}
+
+// DisplayStream sends the screen of a customer display as Server-Sent Events, authorized by the
+// token from CreateDisplaySession. Every event is the whole screen and is only sent when it changed.
+// The stream ends when the display is removed or its pairing code expires unused.
+func (h *PosHandler) DisplayStream(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if len(token) != 32 {
+		http.Error(w, "Display not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	session, err := h.service.repo.FindDisplaySessionByToken(ctx, token)
+	cancel()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Display not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	signal := displays.subscribe(session.ID)
+	defer displays.unsubscribe(session.ID, signal)
+
+	stream := &displayStream{handler: h, token: token}
+	defer stream.close()
+	event, err := stream.load(r.Context())
+	if errors.Is(err, errDisplayGone) {
+		http.Error(w, "Display not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load display: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server write timeout would cut the stream, every write sets its own deadline instead
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(chunk string) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	var lastSent []byte
+	send := func(event *DisplayEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		if bytes.Equal(data, lastSent) {
+			return true
+		}
+		lastSent = data
+		return write(fmt.Sprintf("event: display\ndata: %s\n\n", data))
+	}
+
+	if !write("retry: 3000\n\n") || !send(event) {
+		return
+	}
+
+	ticker := time.NewTicker(sseHeartbeatPeriod)
+	defer ticker.Stop()
+	// Wakes the stream when an unused pairing code expires
+	pairingExpiry := time.NewTimer(time.Hour)
+	defer pairingExpiry.Stop()
+
+	for {
+		pairingExpiry.Stop()
+		if stream.session.PairedAt == nil && stream.session.PairingExpiresAt != nil {
+			pairingExpiry.Reset(time.Until(*stream.session.PairingExpiresAt))
+		}
+		var updates chan *models.Transaction
+		if stream.sub != nil {
+			updates = stream.sub.updates
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+			continue
+		case <-signal:
+		case <-pairingExpiry.C:
+		case _, open := <-updates:
+			if !open {
+				// Dropped for falling behind, load subscribes again
+				stream.sub = nil
+			}
+		}
+
+		event, err := stream.load(r.Context())
+		if err != nil {
+			// Gone or failing, the display reconnects and gets the reason as the status code
+			return
+		}
+		if !send(event) {
+			return
+		}
+	}
+}
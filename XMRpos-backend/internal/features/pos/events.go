@@ -0,0 +1,231 @@
+package pos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// TransactionEventVersion is the schema sent to subscribers that ask for ?version=1.
+// Without it they get the transaction as stored, as before the schema existed.
+const TransactionEventVersion = 1
+
+// Types of the events on a transaction subscription
+const (
+	TransactionEventSnapshot = "snapshot" // the current state, sent on subscribe unless the client resumed at it
+	TransactionEventUpdate   = "update"
+)
+
+// TransactionEvent carries the whole payment state, so the latest event supersedes any that were missed
+type TransactionEvent struct {
+	Version               int            `json:"version"`
+	Type                  string         `json:"type"`
+	Sequence              int64          `json:"sequence"` // increases with every change, pass it back as ?since= to resume
+	TransactionID         uint           `json:"transaction_id"`
+	Status                string         `json:"status"`
+	Accepted              bool           `json:"accepted"`
+	Confirmed             bool           `json:"confirmed"`
+	Amount                int64          `json:"amount"`
+	AmountReceived        int64          `json:"amount_received"`
+	AmountShortfall       int64          `json:"amount_shortfall"`
+	AmountExcess          int64          `json:"amount_excess"`
+	Currency              string         `json:"currency"`
+	AmountInCurrency      float64        `json:"amount_in_currency"`
+	RequiredConfirmations int64          `json:"required_confirmations"`
+	FinalConfirmations    int64          `json:"final_confirmations"`
+	Confirmations         int64          `json:"confirmations"` // of the least confirmed payment, 0 before any payment
+	ExpiresAt             *time.Time     `json:"expires_at"`
+	LatePayment           bool           `json:"late_payment"`
+	PaymentResolution     *string        `json:"payment_resolution"`
+	DoubleSpendSeen       bool           `json:"double_spend_seen"` // acceptance is revoked while a payment is reported double-spent
+	ReviewRequired        bool           `json:"review_required"`
+	ReorgPending          bool           `json:"reorg_pending"`
+	Payments              []PaymentEvent `json:"payments"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+}
+
+type PaymentEvent struct {
+	TxHash          string `json:"tx_hash"`
+	Amount          int64  `json:"amount"`
+	Confirmations   int64  `json:"confirmations"`
+	Height          int64  `json:"height"`
+	DoubleSpendSeen bool   `json:"double_spend_seen"`
+	Locked          bool   `json:"locked"`
+	Orphaned        bool   `json:"orphaned"` // no longer reported by the wallet
+}
+
+// TransactionSequence orders the states of a transaction. Every change moves updated_at, which
+// survives restarts and is the same on every instance.
+func TransactionSequence(transaction *models.Transaction) int64 {
+	return transaction.UpdatedAt.UnixMicro()
+}
+
+func NewTransactionEvent(eventType string, transaction *models.Transaction) TransactionEvent {
+	event := TransactionEvent{
+		Version:               TransactionEventVersion,
+		Type:                  eventType,
+		Sequence:              TransactionSequence(transaction),
+		TransactionID:         transaction.ID,
+		Status:                transaction.Status,
+		Accepted:              transaction.Accepted,
+		Confirmed:             transaction.Confirmed,
+		Amount:                transaction.Amount,
+		AmountReceived:        transaction.AmountReceived,
+		AmountShortfall:       transaction.AmountShortfall,
+		AmountExcess:          transaction.AmountExcess,
+		Currency:              transaction.Currency,
+		AmountInCurrency:      transaction.AmountInCurrency,
+		RequiredConfirmations: transaction.RequiredConfirmations,
+		FinalConfirmations:    transaction.FinalConfirmations,
+		ExpiresAt:             transaction.ExpiresAt,
+		LatePayment:           transaction.LatePayment,
+		PaymentResolution:     transaction.PaymentResolution,
+		DoubleSpendSeen:       transaction.DoubleSpendSeen,
+		ReviewRequired:        transaction.ReviewRequired,
+		ReorgPending:          transaction.ReorgPending,
+		Payments:              make([]PaymentEvent, 0, len(transaction.SubTransactions)),
+		UpdatedAt:             transaction.UpdatedAt,
+	}
+	counted := false
+	for _, sub := range transaction.SubTransactions {
+		if !sub.Orphaned && (!counted || sub.Confirmations < event.Confirmations) {
+			event.Confirmations = sub.Confirmations
+			counted = true
+		}
+		event.Payments = append(event.Payments, PaymentEvent{
+			TxHash:          sub.TxHash,
+			Amount:          sub.Amount,
+			Confirmations:   sub.Confirmations,
+			Height:          sub.Height,
+			DoubleSpendSeen: sub.DoubleSpendSeen,
+			Locked:          sub.Locked,
+			Orphaned:        sub.Orphaned,
+		})
+	}
+	return event
+}
+
+// streamOptions reads ?version= and the sequence to resume from, ?since= or the Last-Event-ID header
+func streamOptions(w http.ResponseWriter, r *http.Request) (version int, since int64, ok bool) {
+	switch value := r.URL.Query().Get("version"); value {
+	case "", "0":
+	case strconv.Itoa(TransactionEventVersion):
+		version = TransactionEventVersion
+	default:
+		http.Error(w, "Unsupported version", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		value = r.Header.Get("Last-Event-ID")
+	}
+	if value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		since = parsed
+	}
+	return version, since, true
+}
+
+// encodeTransaction renders a state for a subscriber of the given version
+func encodeTransaction(version int, eventType string, transaction *models.Transaction) ([]byte, error) {
+	if version == 0 {
+		return json.Marshal(transaction)
+	}
+	return json.Marshal(NewTransactionEvent(eventType, transaction))
+}
+
+// subscription receives the states of one transaction, it is closed when the subscriber falls behind
+type subscription struct {
+	transactionID uint
+	updates       chan *models.Transaction
+}
+
+type transactionHub struct {
+	subscribers map[uint]map[*subscription]struct{} // transactionID -> subscriptions
+	mu          sync.Mutex
+}
+
+var hub = transactionHub{
+	subscribers: make(map[uint]map[*subscription]struct{}),
+}
+
+func (h *transactionHub) subscribe(transactionID uint) *subscription {
+	sub := &subscription{transactionID: transactionID, updates: make(chan *models.Transaction, 16)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[transactionID] == nil {
+		h.subscribers[transactionID] = make(map[*subscription]struct{})
+	}
+	h.subscribers[transactionID][sub] = struct{}{}
+	return sub
+}
+
+func (h *transactionHub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subscribers[sub.transactionID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.updates)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.transactionID)
+	}
+}
+
+// transactionIDs lists the transactions followed on this instance
+func (h *transactionHub) transactionIDs() []uint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]uint, 0, len(h.subscribers))
+	for id := range h.subscribers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// publish sends a state to the WebSocket and SSE subscribers of the transaction on this instance
+func (h *transactionHub) publish(transaction *models.Transaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subscribers[transaction.ID]
+	for sub := range subs {
+		select {
+		case sub.updates <- transaction:
+		default:
+			// Too slow to keep up, closing makes the client reconnect and resume
+			delete(subs, sub)
+			close(sub.updates)
+		}
+	}
+	if len(subs) == 0 {
+		delete(h.subscribers, transaction.ID)
+	}
+}
+
+// currentState loads the transaction once subscribed, so no change falls in between.
+// It is nil when the client resumed at the current sequence.
+func (h *PosHandler) currentState(ctx context.Context, transactionID uint, since int64) (*models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	transaction, err := h.service.repo.FindTransactionByID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if since != 0 && TransactionSequence(transaction) == since {
+		return nil, nil
+	}
+	return transaction, nil
+}
@@ -0,0 +1,233 @@
+package pos
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 200
+)
+
+// TransactionFilter narrows down a transaction listing, zero values mean "no filter"
+type TransactionFilter struct {
+	From      *time.Time
+	To        *time.Time
+	Statuses  []string
+	Currency  string
+	MinAmount *int64
+	MaxAmount *int64
+	Search    string
+	Review    *bool // review_required, e.g. sales held back after a double spend
+	PosID     *uint
+	Limit     int
+	Cursor    *TransactionCursor
+}
+
+// TransactionCursor points at the last transaction of the previous page
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+func (c TransactionCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeTransactionCursor(value string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	transactionID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &TransactionCursor{CreatedAt: time.Unix(0, createdAt), ID: uint(transactionID)}, nil
+}
+
+// ParseTransactionFilter reads limit, cursor, from, to, status, currency, min_amount, max_amount, q, review_required and pos_id
+func ParseTransactionFilter(query url.Values) (TransactionFilter, error) {
+	filter := TransactionFilter{Limit: defaultTransactionPageSize}
+
+	if value := query.Get("pos_id"); value != "" {
+		posID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("pos_id is invalid")
+		}
+		id := uint(posID)
+		filter.PosID = &id
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTransactionPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxTransactionPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := DecodeTransactionCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = cursor
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or unix seconds", param.name)
+		}
+		*param.dest = &t
+	}
+
+	if value := query.Get("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.ToLower(strings.TrimSpace(status))
+			if status == "" {
+				continue
+			}
+			if !isTransactionStatus(status) {
+				return filter, fmt.Errorf("unknown status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	filter.Currency = strings.ToUpper(strings.TrimSpace(query.Get("currency")))
+
+	for _, param := range []struct {
+		name string
+		dest **int64
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an amount in atomic units", param.name)
+		}
+		*param.dest = &amount
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, fmt.Errorf("min_amount must not exceed max_amount")
+	}
+
+	filter.Search = strings.TrimSpace(query.Get("q"))
+
+	if value := query.Get("review_required"); value != "" {
+		review, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("review_required must be true or false")
+		}
+		filter.Review = &review
+	}
+
+	return filter, nil
+}
+
+func isTransactionStatus(status string) bool {
+	switch status {
+	case models.TransactionStatusPending, models.TransactionStatusPaid, models.TransactionStatusUnderpaid,
+		models.TransactionStatusOverpaid, models.TransactionStatusExpired, models.TransactionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// TransactionFilterScope applies the filter, ordering and keyset pagination to a transactions query.
+// One extra row is fetched so callers can tell whether there is a next page.
+func TransactionFilterScope(filter TransactionFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(TransactionConditionsScope(filter))
+		if filter.Cursor != nil {
+			db = db.Where("(transactions.created_at, transactions.id) < (?, ?)", filter.Cursor.CreatedAt, filter.Cursor.ID)
+		}
+		if filter.Limit > 0 {
+			db = db.Limit(filter.Limit + 1)
+		}
+		return db.Order("transactions.created_at DESC, transactions.id DESC")
+	}
+}
+
+// TransactionConditionsScope applies only the filter conditions, for aggregates over the whole result set
+func TransactionConditionsScope(filter TransactionFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.PosID != nil {
+			db = db.Where("transactions.pos_id = ?", *filter.PosID)
+		}
+		if filter.From != nil {
+			db = db.Where("transactions.created_at >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			db = db.Where("transactions.created_at < ?", *filter.To)
+		}
+		if len(filter.Statuses) > 0 {
+			db = db.Where("transactions.status IN ?", filter.Statuses)
+		}
+		if filter.Currency != "" {
+			db = db.Where("transactions.currency = ?", filter.Currency)
+		}
+		if filter.MinAmount != nil {
+			db = db.Where("transactions.amount >= ?", *filter.MinAmount)
+		}
+		if filter.MaxAmount != nil {
+			db = db.Where("transactions.amount <= ?", *filter.MaxAmount)
+		}
+		if filter.Search != "" {
+			db = db.Where("transactions.description ILIKE ?", "%"+escapeLike(filter.Search)+"%")
+		}
+		if filter.Review != nil {
+			db = db.Where("transactions.review_required = ?", *filter.Review)
+		}
+		return db
+	}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// PageTransactions trims the extra row fetched by TransactionFilterScope and returns the cursor for the next page
+func PageTransactions[T any](rows []T, limit int, cursorOf func(T) TransactionCursor) ([]T, *string) {
+	if limit <= 0 || len(rows) <= limit {
+		return rows, nil
+	}
+	rows = rows[:limit]
+	next := cursorOf(rows[len(rows)-1]).Encode()
+	return rows, &next
+}
@@ -2,6 +2,8 @@ package pos
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -22,21 +24,36 @@ func NewPosHandler(service *PosService) *PosHandler {
 }
 
 type createTransactionRequest struct {
-	Amount                int64   `json:"amount"`
-	Description           *string `json:"description"`
-	AmountInCurrency      float64 `json:"amount_in_currency"`
-	Currency              string  `json:"currency"`
-	RequiredConfirmations int64   `json:"required_confirmations"`
+	Amount                int64            `json:"amount"`
+	Description           *string          `json:"description"`
+	AmountInCurrency      float64          `json:"amount_in_currency"`
+	Currency              string           `json:"currency"`
+	RequiredConfirmations *int64           `json:"required_confirmations"` // Rejected, the vendor's confirmation policy decides
+	ExpirySeconds         *int64           `json:"expiry_seconds"`
+	TipAmount             int64            `json:"tip_amount"`
+	TipAmountInCurrency   float64          `json:"tip_amount_in_currency"`
+	TipPercentage         *float64         `json:"tip_percentage"`
+	Items                 []LineItemParams `json:"items"`
+	TaxRateID             *uint            `json:"tax_rate_id"`
+	DiscountCode          *string          `json:"discount_code"`
 }
 
 type createTransactionResponse struct {
-	Id      uint   `json:"id"`
-	Address string `json:"address"`
+	Id           uint      `json:"id"`
+	Address      string    `json:"address"`
+	Amount       int64     `json:"amount"`
+	TipAmount    int64     `json:"tip_amount"`
+	TaxAmount    float64   `json:"tax_amount_in_currency"`
+	Discount     float64   `json:"discount_in_currency"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ExchangeRate *float64  `json:"exchange_rate,omitempty"`
+	PublicToken  string    `json:"public_token"`
 }
 
 type listTransactionsResponse struct {
 	ConfirmedTransactions []ConfirmedTransactionSummary `json:"confirmed_transactions"`
 	PendingTransactions   []PendingTransactionSummary   `json:"pending_transactions"`
+	NextCursor            *string                       `json:"next_cursor"`
 }
 
 func (h *PosHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
@@ -53,8 +70,19 @@ func (h *PosHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RequiredConfirmations > 10 || req.RequiredConfirmations < 0 {
-		http.Error(w, "Required confirmations must be between 0 and 10", http.StatusBadRequest)
+	// Confirmations follow the vendor's confirmation policy, a device asking for others is told so
+	if req.RequiredConfirmations != nil {
+		http.Error(w, "required_confirmations is set by the vendor's confirmation policy", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpirySeconds != nil && (*req.ExpirySeconds < models.MinTransactionExpirySeconds || *req.ExpirySeconds > models.MaxTransactionExpirySeconds) {
+		http.Error(w, "Expiry must be between 60 and 86400 seconds", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount < 0 || req.AmountInCurrency < 0 {
+		http.Error(w, "Amounts must not be negative", http.StatusBadRequest)
 		return
 	}
 
@@ -67,15 +95,54 @@ func (h *PosHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
 
-	id, address, err := h.service.CreateTransaction(ctx, *vendorIDPtr, *posIDPtr, req.Amount, req.Description, req.AmountInCurrency, req.Currency, req.RequiredConfirmations)
-	if err != nil {
-		http.Error(w, "Failed to create transaction", http.StatusInternalServerError)
+	params := CreateTransactionParams{
+		Amount:              req.Amount,
+		Description:         req.Description,
+		AmountInCurrency:    req.AmountInCurrency,
+		Currency:            req.Currency,
+		ExpirySeconds:       req.ExpirySeconds,
+		TipAmount:           req.TipAmount,
+		TipAmountInCurrency: req.TipAmountInCurrency,
+		TipPercentage:       req.TipPercentage,
+		Items:               req.Items,
+		TaxRateID:           req.TaxRateID,
+		DiscountCode:        req.DiscountCode,
+	}
+
+	var result *CreateTransactionResult
+	var httpErr *models.HTTPError
+	if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+		if len(idempotencyKey) > 255 {
+			http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+		// Hash the decoded request so formatting differences do not count as a different body
+		canonical, _ := json.Marshal(req)
+		requestHash := sha256.Sum256(canonical)
+
+		var replayed bool
+		result, replayed, httpErr = h.service.CreateTransactionIdempotent(ctx, *vendorIDPtr, *posIDPtr, idempotencyKey, hex.EncodeToString(requestHash[:]), params)
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+	} else {
+		result, httpErr = h.service.CreateTransaction(ctx, *vendorIDPtr, *posIDPtr, params)
+	}
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
 		return
 	}
 
 	resp := createTransactionResponse{
-		Id:      id,
-		Address: address,
+		Id:           result.ID,
+		Address:      result.Address,
+		Amount:       result.Amount,
+		TipAmount:    result.TipAmount,
+		TaxAmount:    result.TaxAmount,
+		Discount:     result.Discount,
+		ExpiresAt:    result.ExpiresAt,
+		ExchangeRate: result.ExchangeRate,
+		PublicToken:  result.PublicToken,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -118,6 +185,86 @@ func (h *PosHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(transaction)
 }
 
+func (h *PosHandler) CancelTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vars := chi.URLParam(r, "id")
+	transactionID, err := strconv.ParseUint(vars, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
+	if !ok || role != "pos" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil || posIDPtr == nil {
+		http.Error(w, "Vendor ID and POS ID are required", http.StatusBadRequest)
+		return
+	}
+
+	transaction, httpErr := h.service.CancelTransaction(ctx, uint(transactionID), *vendorIDPtr, *posIDPtr)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(transaction)
+	io.Copy(io.Discard, r.Body)
+}
+
+// Returns the payment request as JSON, or just the QR code when format=png or format=svg
+func (h *PosHandler) GetPaymentRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	transactionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
+	if !ok || role != "pos" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil || posIDPtr == nil {
+		http.Error(w, "Vendor ID and POS ID are required", http.StatusBadRequest)
+		return
+	}
+
+	paymentRequest, httpErr := h.service.GetPaymentRequest(ctx, uint(transactionID), *vendorIDPtr, *posIDPtr)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(paymentRequest.QRCodePNG)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		_, _ = io.WriteString(w, paymentRequest.QRCodeSVG)
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(paymentRequest)
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+	}
+}
+
 func (h *PosHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -136,7 +283,13 @@ func (h *PosHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.service.ListTransactionsByPos(ctx, *vendorIDPtr, *posIDPtr)
+	filter, err := ParseTransactionFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.ListTransactionsByPos(ctx, *vendorIDPtr, *posIDPtr, filter)
 	if err != nil {
 		http.Error(w, "Failed to list transactions", http.StatusInternalServerError)
 		return
@@ -145,6 +298,7 @@ func (h *PosHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	resp := listTransactionsResponse{
 		ConfirmedTransactions: result.Confirmed,
 		PendingTransactions:   result.Pending,
+		NextCursor:            result.NextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,114 @@
+package pos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const paymentQRSize = 512
+
+type PaymentRequest struct {
+	TransactionID uint   `json:"transaction_id"`
+	URI           string `json:"uri"`
+	Address       string `json:"address"`
+	Amount        int64  `json:"amount"` // Atomic units still due
+	Description   string `json:"description,omitempty"`
+	RecipientName string `json:"recipient_name"`
+	QRCodePNG     []byte `json:"qr_code_png"` // Base64 encoded in JSON
+	QRCodeSVG     string `json:"qr_code_svg"`
+}
+
+// GetPaymentRequest builds the monero: URI and QR codes for a transaction
+func (s *PosService) GetPaymentRequest(ctx context.Context, transactionID uint, vendorID uint, posID uint) (*PaymentRequest, *models.HTTPError) {
+	transaction, httpErr := s.GetTransaction(ctx, transactionID, vendorID, posID)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	return s.buildPaymentRequest(ctx, transaction)
+}
+
+func (s *PosService) buildPaymentRequest(ctx context.Context, transaction *models.Transaction) (*PaymentRequest, *models.HTTPError) {
+	if transaction.SubAddress == nil || *transaction.SubAddress == "" {
+		return nil, models.NewHTTPError(http.StatusConflict, "Transaction has no payment address yet")
+	}
+
+	vendor, err := s.repo.FindVendorByID(ctx, transaction.VendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to load vendor: "+err.Error())
+	}
+
+	// An underpaid transaction only asks for what is missing
+	amount := transaction.Amount
+	if transaction.Status == models.TransactionStatusUnderpaid && transaction.AmountShortfall > 0 {
+		amount = transaction.AmountShortfall
+	}
+
+	var description string
+	if transaction.Description != nil {
+		description = *transaction.Description
+	}
+
+	uri := buildMoneroURI(*transaction.SubAddress, amount, description, vendor.Name)
+
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to render QR code: "+err.Error())
+	}
+	png, err := qr.PNG(paymentQRSize)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to render QR code: "+err.Error())
+	}
+
+	return &PaymentRequest{
+		TransactionID: transaction.ID,
+		URI:           uri,
+		Address:       *transaction.SubAddress,
+		Amount:        amount,
+		Description:   description,
+		RecipientName: vendor.Name,
+		QRCodePNG:     png,
+		QRCodeSVG:     renderQRCodeSVG(qr),
+	}, nil
+}
+
+// buildMoneroURI follows the Monero URI scheme, e.g. monero:8...?tx_amount=1.5&tx_description=Coffee&recipient_name=Shop
+func buildMoneroURI(address string, amount int64, description string, recipientName string) string {
+	params := []string{"tx_amount=" + utils.FormatXMR(amount)}
+	if description != "" {
+		params = append(params, "tx_description="+escapeURIValue(description))
+	}
+	if recipientName != "" {
+		params = append(params, "recipient_name="+escapeURIValue(recipientName))
+	}
+	return "monero:" + address + "?" + strings.Join(params, "&")
+}
+
+// Wallets do not agree on "+" as a space, so always percent encode it
+func escapeURIValue(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func renderQRCodeSVG(qr *qrcode.QRCode) string {
+	bitmap := qr.Bitmap()
+	size := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`, size, size, size, size, path.String())
+}
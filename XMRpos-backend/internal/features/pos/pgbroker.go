@@ -0,0 +1,132 @@
+package pos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	brokerChannel = "xmrpos_events"
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more
+	maxNotifyPayload = 7999
+)
+
+// PostgresBroker delivers to the clients of this instance right away and publishes with NOTIFY for the
+// other instances sharing the database, which deliver what LISTEN receives. Messages sent while the
+// listener reconnects are missed, so once it is back the local clients are made to reload their state.
+type PostgresBroker struct {
+	db         *gorm.DB
+	dsn        string
+	repo       PosRepository
+	instanceID string // tells our own notifications apart, they were delivered when published
+}
+
+func NewPostgresBroker(db *gorm.DB, dsn string, repo PosRepository) *PostgresBroker {
+	return &PostgresBroker{db: db, dsn: dsn, repo: repo, instanceID: gonanoid.Must()}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, message *BrokerMessage) error {
+	if err := loadTransaction(ctx, b.repo, message); err != nil {
+		return err
+	}
+	deliver(message)
+
+	message.Origin = b.instanceID
+	if err := b.notify(ctx, message); err != nil {
+		// Delivered here already, so only the other instances miss it
+		log.Printf("broker: notify failed, other instances miss the message: %v", err)
+	}
+	return nil
+}
+
+func (b *PostgresBroker) notify(ctx context.Context, message *BrokerMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("message of %d bytes is too large for NOTIFY", len(payload))
+	}
+	return b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", brokerChannel, string(payload)).Error
+}
+
+// Listen delivers notifications until ctx is done, reconnecting after connection errors
+func (b *PostgresBroker) Listen(ctx context.Context) {
+	for reconnect := false; ; reconnect = true {
+		err := b.listen(ctx, reconnect)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("broker: listener stopped, reconnecting: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (b *PostgresBroker) listen(ctx context.Context, reconnect bool) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+brokerChannel); err != nil {
+		return err
+	}
+	if reconnect {
+		b.resync(ctx)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var message BrokerMessage
+		if err := json.Unmarshal([]byte(notification.Payload), &message); err != nil {
+			log.Printf("broker: invalid message: %v", err)
+			continue
+		}
+		if message.Origin == b.instanceID {
+			continue
+		}
+		loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = loadTransaction(loadCtx, b.repo, &message)
+		cancel()
+		if err != nil {
+			log.Printf("broker: failed to load transaction %d: %v", message.TransactionID, err)
+			continue
+		}
+		deliver(&message)
+	}
+}
+
+// resync wakes the clients of this instance after the listener was down: transaction streams get the
+// stored state, displays reload, and vendor feeds are closed so their clients reconnect and refetch.
+func (b *PostgresBroker) resync(ctx context.Context) {
+	for _, transactionID := range hub.transactionIDs() {
+		loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		transaction, err := b.repo.FindTransactionByID(loadCtx, transactionID)
+		cancel()
+		if err != nil {
+			log.Printf("broker: failed to reload transaction %d: %v", transactionID, err)
+			continue
+		}
+		hub.publish(transaction)
+	}
+	for _, sessionID := range displays.sessionIDs() {
+		displays.notify(sessionID)
+	}
+	vendorFeed.closeAll("events may have been missed, reconnect")
+}
@@ -2,16 +2,40 @@ package pos
 
 import (
 	"context"
+	"time"
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/inventory"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/promotion"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PosRepository interface {
 	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
-	CreateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
+	CreateTransaction(ctx context.Context, transaction *models.Transaction, promo *models.Promotion) (*models.Transaction, error)
 	UpdateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
-	FindTransactionsByPosID(ctx context.Context, vendorID uint, posID uint) ([]*models.Transaction, error)
+	FindTransactionsByPosID(ctx context.Context, vendorID uint, posID uint, filter TransactionFilter) ([]*models.Transaction, error)
+	FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error)
+	PosExists(ctx context.Context, vendorID uint, posID uint) (bool, error)
+	FindTaxRate(ctx context.Context, vendorID uint, id uint) (*models.TaxRate, error)
+	FindDefaultTaxRate(ctx context.Context, vendorID uint) (*models.TaxRate, error)
+	FindPromotionByCode(ctx context.Context, vendorID uint, code string) (*models.Promotion, error)
+	UpdateTransactionStatus(ctx context.Context, id uint, fromStatus string, toStatus string) (bool, error)
+	ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	FindIdempotencyKey(ctx context.Context, posID uint, key string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, id uint, transactionID uint, response string) error
+	DeleteIdempotencyKey(ctx context.Context, id uint) error
+	CreateDisplaySession(ctx context.Context, session *models.DisplaySession) (bool, error)
+	DeleteExpiredDisplayPairings(ctx context.Context, now time.Time) error
+	CountDisplayPairings(ctx context.Context, now time.Time) (int64, error)
+	FindDisplaySessionByToken(ctx context.Context, token string) (*models.DisplaySession, error)
+	FindDisplaySession(ctx context.Context, posID uint, id uint) (*models.DisplaySession, error)
+	ListDisplaySessions(ctx context.Context, posID uint) ([]*models.DisplaySession, error)
+	PairDisplaySession(ctx context.Context, code string, vendorID uint, posID uint, name *string, now time.Time) (*models.DisplaySession, error)
+	UpdateDisplaySession(ctx context.Context, posID uint, id uint, updates map[string]interface{}) error
+	DeleteDisplaySession(ctx context.Context, posID uint, id uint) error
+	ShowTransactionOnDisplays(ctx context.Context, posID uint, transactionID uint) ([]uint, error)
 }
 
 type posRepository struct {
@@ -27,17 +51,30 @@ func (r *posRepository) FindTransactionByID(ctx context.Context, id uint) (*mode
 		ctx = context.Background()
 	}
 	var transaction models.Transaction
-	if err := r.db.WithContext(ctx).Preload("SubTransactions").First(&transaction, id).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("SubTransactions").Preload("LineItems").First(&transaction, id).Error; err != nil {
 		return nil, err
 	}
 	return &transaction, nil
 }
 
-func (r *posRepository) CreateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error) {
+// CreateTransaction stores the sale together with what it holds: a use of promo when it is set,
+// and stock for the cart. A used up code or a sold out SKU fails the whole create.
+func (r *posRepository) CreateTransaction(ctx context.Context, transaction *models.Transaction, promo *models.Promotion) (*models.Transaction, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if err := r.db.WithContext(ctx).Create(transaction).Error; err != nil {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if promo != nil {
+			if err := promotion.Redeem(tx, promo.ID, promo.UpdatedAt, time.Now()); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		return inventory.Reserve(tx, transaction.VendorID, transaction.ID, inventory.QuantitiesBySKU(transaction.LineItems))
+	})
+	if err != nil {
 		return nil, err
 	}
 	return transaction, nil
@@ -53,7 +90,7 @@ func (r *posRepository) UpdateTransaction(ctx context.Context, transaction *mode
 	return transaction, nil
 }
 
-func (r *posRepository) FindTransactionsByPosID(ctx context.Context, vendorID uint, posID uint) ([]*models.Transaction, error) {
+func (r *posRepository) FindTransactionsByPosID(ctx context.Context, vendorID uint, posID uint, filter TransactionFilter) ([]*models.Transaction, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -61,11 +98,283 @@ func (r *posRepository) FindTransactionsByPosID(ctx context.Context, vendorID ui
 	var transactions []*models.Transaction
 	if err := r.db.WithContext(ctx).
 		Preload("SubTransactions").
-		Where("vendor_id = ? AND pos_id = ?", vendorID, posID).
-		Order("created_at DESC").
+		Where("transactions.vendor_id = ? AND transactions.pos_id = ?", vendorID, posID).
+		Scopes(TransactionFilterScope(filter)).
 		Find(&transactions).Error; err != nil {
 		return nil, err
 	}
 
 	return transactions, nil
 }
+
+func (r *posRepository) FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var vendor models.Vendor
+	if err := r.db.WithContext(ctx).First(&vendor, id).Error; err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
+func (r *posRepository) PosExists(ctx context.Context, vendorID uint, posID uint) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Pos{}).Where("id = ? AND vendor_id = ?", posID, vendorID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *posRepository) FindTaxRate(ctx context.Context, vendorID uint, id uint) (*models.TaxRate, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var taxRate models.TaxRate
+	if err := r.db.WithContext(ctx).Where("id = ? AND vendor_id = ?", id, vendorID).First(&taxRate).Error; err != nil {
+		return nil, err
+	}
+	return &taxRate, nil
+}
+
+func (r *posRepository) FindPromotionByCode(ctx context.Context, vendorID uint, code string) (*models.Promotion, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var promo models.Promotion
+	if err := r.db.WithContext(ctx).Preload("Pos").Where("vendor_id = ? AND code = ?", vendorID, code).First(&promo).Error; err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+func (r *posRepository) FindDefaultTaxRate(ctx context.Context, vendorID uint) (*models.TaxRate, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var taxRate models.TaxRate
+	if err := r.db.WithContext(ctx).Where("vendor_id = ? AND \"default\" = ?", vendorID, true).First(&taxRate).Error; err != nil {
+		return nil, err
+	}
+	return &taxRate, nil
+}
+
+// Move a transaction to a new status only if it is still in the expected one.
+// Cancelling releases the stock reserved for the sale and gives back its use of a discount code.
+func (r *posRepository) UpdateTransactionStatus(ctx context.Context, id uint, fromStatus string, toStatus string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	updated := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Transaction{}).
+			Where("id = ? AND status = ?", id, fromStatus).
+			Update("status", toStatus)
+		if result.Error != nil {
+			return result.Error
+		}
+		updated = result.RowsAffected > 0
+		if !updated || toStatus != models.TransactionStatusCancelled {
+			return nil
+		}
+		if err := promotion.Release(tx, id); err != nil {
+			return err
+		}
+		return inventory.Release(tx, id)
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
+// Insert the key unless this POS already used it, reports whether it was inserted
+func (r *posRepository) ClaimIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *posRepository) FindIdempotencyKey(ctx context.Context, posID uint, key string) (*models.IdempotencyKey, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var idempotencyKey models.IdempotencyKey
+	if err := r.db.WithContext(ctx).Where("pos_id = ? AND key = ?", posID, key).First(&idempotencyKey).Error; err != nil {
+		return nil, err
+	}
+	return &idempotencyKey, nil
+}
+
+func (r *posRepository) CompleteIdempotencyKey(ctx context.Context, id uint, transactionID uint, response string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"transaction_id": transactionID,
+			"response":       response,
+		}).Error
+}
+
+// Hard delete so the unique index frees the key again
+func (r *posRepository) DeleteIdempotencyKey(ctx context.Context, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Unscoped().Delete(&models.IdempotencyKey{}, id).Error
+}
+
+// CreateDisplaySession reports false when the pairing code is taken by another display
+func (r *posRepository) CreateDisplaySession(ctx context.Context, session *models.DisplaySession) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(session)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteExpiredDisplayPairings frees the codes of displays that were never paired
+func (r *posRepository) DeleteExpiredDisplayPairings(ctx context.Context, now time.Time) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Unscoped().
+		Where("paired_at IS NULL AND pairing_expires_at < ?", now).
+		Delete(&models.DisplaySession{}).Error
+}
+
+// CountDisplayPairings counts the displays still showing a valid pairing code
+func (r *posRepository) CountDisplayPairings(ctx context.Context, now time.Time) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.DisplaySession{}).
+		Where("paired_at IS NULL AND pairing_expires_at > ?", now).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *posRepository) FindDisplaySessionByToken(ctx context.Context, token string) (*models.DisplaySession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var session models.DisplaySession
+	if err := r.db.WithContext(ctx).Where("token = ?", token).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *posRepository) FindDisplaySession(ctx context.Context, posID uint, id uint) (*models.DisplaySession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var session models.DisplaySession
+	if err := r.db.WithContext(ctx).Where("id = ? AND pos_id = ?", id, posID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *posRepository) ListDisplaySessions(ctx context.Context, posID uint) ([]*models.DisplaySession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var sessions []*models.DisplaySession
+	if err := r.db.WithContext(ctx).Where("pos_id = ?", posID).Order("id ASC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// PairDisplaySession claims the display showing code for the POS, only while the code is valid
+func (r *posRepository) PairDisplaySession(ctx context.Context, code string, vendorID uint, posID uint, name *string, now time.Time) (*models.DisplaySession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var session models.DisplaySession
+	result := r.db.WithContext(ctx).Model(&session).
+		Clauses(clause.Returning{}).
+		Where("pairing_code = ? AND paired_at IS NULL AND pairing_expires_at > ?", code, now).
+		Updates(map[string]interface{}{
+			"vendor_id":          vendorID,
+			"pos_id":             posID,
+			"name":               name,
+			"paired_at":          now,
+			"pairing_code":       nil,
+			"pairing_expires_at": nil,
+			"state":              models.DisplayStateIdle,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (r *posRepository) UpdateDisplaySession(ctx context.Context, posID uint, id uint, updates map[string]interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Model(&models.DisplaySession{}).Where("id = ? AND pos_id = ?", id, posID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *posRepository) DeleteDisplaySession(ctx context.Context, posID uint, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Unscoped().Where("id = ? AND pos_id = ?", id, posID).Delete(&models.DisplaySession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ShowTransactionOnDisplays moves every display of the POS to the payment of a new transaction
+func (r *posRepository) ShowTransactionOnDisplays(ctx context.Context, posID uint, transactionID uint) ([]uint, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var sessions []*models.DisplaySession
+	if err := r.db.WithContext(ctx).Model(&sessions).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("pos_id = ?", posID).
+		Updates(map[string]interface{}{
+			"state":          models.DisplayStatePayment,
+			"transaction_id": transactionID,
+			"cart":           nil,
+		}).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids, nil
+}
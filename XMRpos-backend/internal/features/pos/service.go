@@ -2,23 +2,35 @@ package pos
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/inventory"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/promotion"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/rates"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
+	"gorm.io/gorm"
 )
 
 type PosService struct {
 	repo      PosRepository
 	config    *config.Config
 	moneroPay *moneropay.MoneroPayAPIClient
+	rates     *rates.RatesService
 }
 
-func NewPosService(repo PosRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *PosService {
-	return &PosService{repo: repo, config: cfg, moneroPay: moneroPay}
+func NewPosService(repo PosRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient, ratesService *rates.RatesService) *PosService {
+	return &PosService{repo: repo, config: cfg, moneroPay: moneroPay, rates: ratesService}
 }
 
 type ConfirmedTransactionSummary struct {
@@ -31,46 +43,211 @@ type ConfirmedTransactionSummary struct {
 }
 
 type PendingTransactionSummary struct {
-	ID        uint  `json:"id"`
-	Amount    int64 `json:"amount"`
-	Accepted  bool  `json:"accepted"`
-	Confirmed bool  `json:"confirmed"`
+	ID        uint       `json:"id"`
+	Amount    int64      `json:"amount"`
+	Accepted  bool       `json:"accepted"`
+	Confirmed bool       `json:"confirmed"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at"`
 }
 
 type ListTransactionsResult struct {
-	Confirmed []ConfirmedTransactionSummary `json:"confirmed_transactions"`
-	Pending   []PendingTransactionSummary   `json:"pending_transactions"`
+	Confirmed  []ConfirmedTransactionSummary `json:"confirmed_transactions"`
+	Pending    []PendingTransactionSummary   `json:"pending_transactions"`
+	NextCursor *string                       `json:"next_cursor"`
 }
 
-func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID uint, amount int64, description *string, amountInCurrency float64, currency string, requiredConfirmations int64) (id uint, address string, err error) {
+type CreateTransactionParams struct {
+	Amount              int64 // Atomic units, computed from AmountInCurrency when zero
+	Description         *string
+	AmountInCurrency    float64
+	Currency            string
+	ExpirySeconds       *int64 // Overrides the vendor default when set
+	TipAmount           int64  // Fixed tip in atomic units, computed from TipAmountInCurrency when zero
+	TipAmountInCurrency float64
+	TipPercentage       *float64         // Tip as a percentage of the sale, instead of a fixed tip
+	Items               []LineItemParams // Cart, its total must match AmountInCurrency when both are given
+	TaxRateID           *uint            // Vendor tax rate to apply, the default rate when nil and no tax when 0
+	DiscountCode        *string          // Promotion code, priced on the entered amount before tax
+}
+
+type CreateTransactionResult struct {
+	ID           uint      `json:"id"`
+	Address      string    `json:"address"`
+	Amount       int64     `json:"amount"`
+	TipAmount    int64     `json:"tip_amount"`
+	TaxAmount    float64   `json:"tax_amount_in_currency"`
+	Discount     float64   `json:"discount_in_currency"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ExchangeRate *float64  `json:"exchange_rate,omitempty"`
+	PublicToken  string    `json:"public_token"`
+}
+
+func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID uint, params CreateTransactionParams) (result *CreateTransactionResult, httpErr *models.HTTPError) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	vendor, err := s.repo.FindVendorByID(ctx, vendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to load vendor: "+err.Error())
+	}
+
+	// The cart total is the sale amount, unit prices are entered the same way as any other price
+	lineItems, cartTotal, httpErr := buildLineItems(params.Items)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if len(lineItems) > 0 {
+		if params.AmountInCurrency == 0 {
+			params.AmountInCurrency = cartTotal
+		} else if math.Abs(params.AmountInCurrency-cartTotal) > cartTotalTolerance {
+			return nil, models.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("amount_in_currency does not match the cart total of %.2f", cartTotal))
+		}
+	}
+
+	// The discount comes off the entered amounts, before tax and tip. The code is only redeemed with the sale below.
+	var promo *models.Promotion
+	var discount float64
+	if params.DiscountCode != nil && *params.DiscountCode != "" {
+		promo, err = s.repo.FindPromotionByCode(ctx, vendorID, promotion.NormalizeCode(*params.DiscountCode))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "Unknown discount code")
+		}
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to load discount code: "+err.Error())
+		}
+		discount, httpErr = promotion.Discount(promo, posID, params.AmountInCurrency, params.Currency, time.Now())
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		if params.Amount != 0 {
+			params.Amount = int64(math.Round(float64(params.Amount) * (params.AmountInCurrency - discount) / params.AmountInCurrency))
+		}
+		params.AmountInCurrency = roundFiat(params.AmountInCurrency - discount)
+	}
+
+	// Prices are gross or net depending on the vendor, exclusive tax is added on top of the entered amounts
+	taxRate, httpErr := s.resolveTaxRate(ctx, vendorID, params.TaxRateID, params.AmountInCurrency)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	tax := computeTax(params.AmountInCurrency, taxRate, vendor.PricesIncludeTax)
+	if !tax.Inclusive && tax.Tax > 0 {
+		if params.Amount != 0 {
+			params.Amount = int64(math.Round(float64(params.Amount) * tax.Gross / tax.Net))
+		}
+		params.AmountInCurrency = tax.Gross
+	}
+
+	// Check the conversion server side when rates are configured, and derive the XMR amount for fiat only requests
+	var rate *rates.Rate
+	if s.rates != nil && s.rates.Enabled() && params.Currency != "" {
+		rate, err = s.rates.GetRate(ctx, params.Currency)
+		if err != nil {
+			// The amount cannot be checked without a rate, so no payment is requested unchecked
+			log.Printf("Exchange rate for %s unavailable: %v", params.Currency, err)
+			return nil, models.NewHTTPError(http.StatusServiceUnavailable, "Exchange rate unavailable, try again later")
+		}
+	}
+
+	amount := params.Amount
+	if amount == 0 {
+		if rate == nil {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "Exchange rates are not configured, amount is required")
+		}
+		amount = rates.FiatToAtomic(params.AmountInCurrency, rate.Rate)
+	} else if rate != nil && !s.rates.WithinTolerance(amount, params.AmountInCurrency, rate.Rate) {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "Amount does not match amount_in_currency at the current exchange rate")
+	}
+
+	if amount <= 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "Amount must be positive")
+	}
+
+	// The tip is charged on top of the sale, Amount and AmountInCurrency hold the total
+	tip, httpErr := computeTip(params, amount, rate, s.rates)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	// The request may override the vendor's default lifetime
+	lifetime := vendor.TransactionExpirySeconds
+	if params.ExpirySeconds != nil {
+		lifetime = *params.ExpirySeconds
+	}
+	expiresAt := time.Now().Add(time.Duration(lifetime) * time.Second)
+
+	// Unguessable, it is all the customer status page asks for
+	publicToken, err := gonanoid.New(32)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to generate public token: "+err.Error())
+	}
+
+	// The vendor's confirmation policy decides how long the sale waits, not the device
+	requiredConfirmations, finalConfirmations := s.confirmationPolicy(ctx, vendor, amount+tip.Amount, params.Currency, params.AmountInCurrency+tip.AmountInCurrency)
+
 	transaction := &models.Transaction{
 		VendorID:              vendorID,
 		PosID:                 posID,
-		Amount:                amount,
+		Amount:                amount + tip.Amount,
 		RequiredConfirmations: requiredConfirmations,
-		Currency:              currency,
-		AmountInCurrency:      amountInCurrency,
-		Description:           description,
+		FinalConfirmations:    finalConfirmations,
+		Currency:              params.Currency,
+		AmountInCurrency:      params.AmountInCurrency + tip.AmountInCurrency,
+		TipType:               tip.Type,
+		TipPercentage:         tip.Percentage,
+		TipAmount:             tip.Amount,
+		TipAmountInCurrency:   tip.AmountInCurrency,
+		TaxRateID:             tax.RateID,
+		TaxName:               tax.Name,
+		TaxRate:               tax.Rate,
+		TaxInclusive:          tax.Inclusive,
+		NetAmountInCurrency:   tax.Net,
+		TaxAmountInCurrency:   tax.Tax,
+		GrossAmountInCurrency: tax.Gross,
+		DiscountInCurrency:    discount,
+		Description:           params.Description,
+		LineItems:             lineItems,
+		Status:                models.TransactionStatusPending,
+		ExpiresAt:             &expiresAt,
+		PublicToken:           &publicToken,
+	}
+
+	if rate != nil {
+		transaction.ExchangeRate = &rate.Rate
+		transaction.ExchangeRateSource = &rate.Source
+		transaction.ExchangeRateAt = &rate.FetchedAt
+	}
+
+	if promo != nil {
+		transaction.PromotionID = &promo.ID
+		transaction.PromotionCode = &promo.Code
 	}
 
-	transactionDB, err := s.repo.CreateTransaction(ctx, transaction)
+	transactionDB, err := s.repo.CreateTransaction(ctx, transaction, promo)
 	if err != nil {
-		return 0, "", err
+		if errors.Is(err, promotion.ErrUnavailable) {
+			return nil, models.NewHTTPError(http.StatusConflict, "Discount code is no longer available")
+		}
+		var stockErr *inventory.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return nil, models.NewHTTPError(http.StatusConflict, fmt.Sprintf("Insufficient stock for SKU %s: %d available", stockErr.SKU, stockErr.Available))
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to create transaction: "+err.Error())
 	}
 
 	// Create a jwt token for the transaction which contains the transaction ID
+	// The token outlives the transaction so that late payments are still recorded
 	moneroPayTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"transaction_id": transactionDB.ID,
-		"exp":            time.Now().Add(time.Hour * 6).Unix(),
+		"exp":            expiresAt.Add(time.Hour * 6).Unix(),
 	})
 
 	accessToken, err := moneroPayTokenJWT.SignedString([]byte(s.config.JWTMoneroPaySecret))
 	if err != nil {
-		return 0, "", err
+		s.abandonTransaction(ctx, transactionDB.ID)
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to sign callback token: "+err.Error())
 	}
 
 	callbackURLTemplate := s.config.MoneroPayCallbackURL
@@ -82,12 +259,12 @@ func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID
 	}
 
 	var desc string
-	if description != nil {
-		desc = *description
+	if params.Description != nil {
+		desc = *params.Description
 	}
 
 	req := &moneropay.ReceiveRequest{
-		Amount:      amount,
+		Amount:      transactionDB.Amount,
 		Description: desc,
 		CallbackUrl: callbackUrl,
 	}
@@ -97,16 +274,157 @@ func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID
 	defer cancel()
 	resp, err := s.moneroPay.PostReceive(callCtx, req)
 	if err != nil {
-		return 0, "", err
+		s.abandonTransaction(ctx, transactionDB.ID)
+		return nil, models.NewHTTPError(http.StatusBadGateway, "Failed to create receive address: "+err.Error())
 	}
 
 	// Update the transaction with the subaddress received from MoneroPay
 	transactionDB.SubAddress = &resp.Address
 	if _, err := s.repo.UpdateTransaction(ctx, transactionDB); err != nil {
-		return 0, "", err
+		s.abandonTransaction(ctx, transactionDB.ID)
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to update transaction: "+err.Error())
+	}
+	go NotifyTransactionEvent(transactionDB, VendorEventTransactionCreated)
+	// Paired customer displays switch to the new payment
+	s.showTransactionOnDisplays(ctx, posID, transactionDB.ID)
+
+	return &CreateTransactionResult{
+		ID:           transactionDB.ID,
+		Address:      resp.Address,
+		Amount:       transactionDB.Amount,
+		TipAmount:    transactionDB.TipAmount,
+		TaxAmount:    transactionDB.TaxAmountInCurrency,
+		Discount:     transactionDB.DiscountInCurrency,
+		ExpiresAt:    expiresAt,
+		ExchangeRate: transactionDB.ExchangeRate,
+		PublicToken:  publicToken,
+	}, nil
+}
+
+// abandonTransaction cancels a sale the customer never got a payment address for, so the stock and
+// discount code use it reserved are free again. It runs even when the request was cancelled.
+func (s *PosService) abandonTransaction(ctx context.Context, transactionID uint) {
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if _, err := s.repo.UpdateTransactionStatus(writeCtx, transactionID, models.TransactionStatusPending, models.TransactionStatusCancelled); err != nil {
+		log.Printf("Failed to cancel transaction %d without a payment address: %v", transactionID, err)
+	}
+}
+
+// resolveTaxRate picks the tax rate of a sale. Without a fiat price there is nothing to tax,
+// so the default rate is skipped and an explicitly chosen rate is rejected.
+func (s *PosService) resolveTaxRate(ctx context.Context, vendorID uint, taxRateID *uint, amountInCurrency float64) (*models.TaxRate, *models.HTTPError) {
+	if taxRateID != nil {
+		if *taxRateID == 0 {
+			return nil, nil
+		}
+		if amountInCurrency <= 0 {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "amount_in_currency is required to compute tax")
+		}
+		taxRate, err := s.repo.FindTaxRate(ctx, vendorID, *taxRateID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "Unknown tax_rate_id")
+		}
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to load tax rate: "+err.Error())
+		}
+		return taxRate, nil
+	}
+
+	if amountInCurrency <= 0 {
+		return nil, nil
+	}
+	taxRate, err := s.repo.FindDefaultTaxRate(ctx, vendorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to load tax rate: "+err.Error())
+	}
+	return taxRate, nil
+}
+
+// Idempotency keys can be reused after this long
+const idempotencyKeyLifetime = 24 * time.Hour
+
+// A claim still without a response after this long belongs to a request that died, a retry takes it over
+const idempotencyKeyLease = time.Minute
+
+// CreateTransactionIdempotent runs CreateTransaction at most once per POS and idempotency key.
+// A replay gets the stored result back, reusing the key for a different request is a conflict.
+func (s *PosService) CreateTransactionIdempotent(ctx context.Context, vendorID uint, posID uint, key string, requestHash string, params CreateTransactionParams) (result *CreateTransactionResult, replayed bool, httpErr *models.HTTPError) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	idempotencyKey := &models.IdempotencyKey{
+		PosID:       posID,
+		Key:         key,
+		RequestHash: requestHash,
+	}
+
+	claimed, err := s.repo.ClaimIdempotencyKey(ctx, idempotencyKey)
+	if err != nil {
+		return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to store idempotency key: "+err.Error())
+	}
+
+	if !claimed {
+		existing, err := s.repo.FindIdempotencyKey(ctx, posID, key)
+		if err != nil {
+			return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to load idempotency key: "+err.Error())
+		}
+
+		abandoned := existing.Response == nil && time.Since(existing.UpdatedAt) > idempotencyKeyLease
+		if time.Since(existing.CreatedAt) <= idempotencyKeyLifetime && !abandoned {
+			if existing.RequestHash != requestHash {
+				return nil, false, models.NewHTTPError(http.StatusConflict, "Idempotency-Key was already used for a different request")
+			}
+			if existing.Response == nil {
+				return nil, false, models.NewHTTPError(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			}
+
+			var stored CreateTransactionResult
+			if err := json.Unmarshal([]byte(*existing.Response), &stored); err != nil {
+				return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to read stored response: "+err.Error())
+			}
+			return &stored, true, nil
+		}
+
+		// The old key has expired or its request never finished, start over with it
+		if err := s.repo.DeleteIdempotencyKey(ctx, existing.ID); err != nil {
+			return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to delete idempotency key: "+err.Error())
+		}
+		claimed, err = s.repo.ClaimIdempotencyKey(ctx, idempotencyKey)
+		if err != nil {
+			return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to store idempotency key: "+err.Error())
+		}
+		if !claimed {
+			return nil, false, models.NewHTTPError(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		}
+	}
+
+	result, httpErr = s.CreateTransaction(ctx, vendorID, posID, params)
+
+	// The key is released or completed even when the client went away, or its retry would be locked out
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if httpErr != nil {
+		// Let the client retry with the same key
+		if err := s.repo.DeleteIdempotencyKey(writeCtx, idempotencyKey.ID); err != nil {
+			log.Printf("Failed to release idempotency key %d: %v", idempotencyKey.ID, err)
+		}
+		return nil, false, httpErr
 	}
 
-	return transactionDB.ID, resp.Address, nil
+	response, err := json.Marshal(result)
+	if err != nil {
+		return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to store response: "+err.Error())
+	}
+	if err := s.repo.CompleteIdempotencyKey(writeCtx, idempotencyKey.ID, result.ID, string(response)); err != nil {
+		return nil, false, models.NewHTTPError(http.StatusInternalServerError, "Failed to store response: "+err.Error())
+	}
+
+	return result, false, nil
 }
 
 // GetTransaction retrieves a transaction by its ID if authorized
@@ -128,6 +446,32 @@ func (s *PosService) GetTransaction(ctx context.Context, transactionID uint, ven
 	return transaction, nil
 }
 
+// CancelTransaction abandons a transaction that has not been paid yet
+func (s *PosService) CancelTransaction(ctx context.Context, transactionID uint, vendorID uint, posID uint) (transaction *models.Transaction, httpErr *models.HTTPError) {
+	transaction, httpErr = s.GetTransaction(ctx, transactionID, vendorID, posID)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	if transaction.Status != models.TransactionStatusPending {
+		return nil, models.NewHTTPError(http.StatusConflict, "Only pending transactions can be cancelled")
+	}
+
+	updated, err := s.repo.UpdateTransactionStatus(ctx, transaction.ID, models.TransactionStatusPending, models.TransactionStatusCancelled)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to cancel transaction: "+err.Error())
+	}
+	if !updated {
+		// The status changed underneath us, e.g. a payment arrived or the transaction expired
+		return nil, models.NewHTTPError(http.StatusConflict, "Only pending transactions can be cancelled")
+	}
+
+	transaction.Status = models.TransactionStatusCancelled
+	go NotifyTransactionEvent(transaction, TransactionEventTypes(models.TransactionStatusPending, transaction.Confirmed, transaction)...)
+
+	return transaction, nil
+}
+
 // Check if the vendor and POS are authorized for the transaction
 func (s *PosService) IsAuthorizedForTransaction(vendorID uint, posID uint, transaction *models.Transaction) bool {
 	if transaction.VendorID != vendorID || transaction.PosID != posID {
@@ -136,19 +480,25 @@ func (s *PosService) IsAuthorizedForTransaction(vendorID uint, posID uint, trans
 	return true
 }
 
-func (s *PosService) ListTransactionsByPos(ctx context.Context, vendorID uint, posID uint) (*ListTransactionsResult, error) {
+func (s *PosService) ListTransactionsByPos(ctx context.Context, vendorID uint, posID uint, filter TransactionFilter) (*ListTransactionsResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	transactions, err := s.repo.FindTransactionsByPosID(ctx, vendorID, posID)
+	filter.PosID = nil // A POS only ever sees its own transactions
+	transactions, err := s.repo.FindTransactionsByPosID(ctx, vendorID, posID, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	transactions, nextCursor := PageTransactions(transactions, filter.Limit, func(t *models.Transaction) TransactionCursor {
+		return TransactionCursor{CreatedAt: t.CreatedAt, ID: t.ID}
+	})
+
 	result := &ListTransactionsResult{
-		Confirmed: make([]ConfirmedTransactionSummary, 0),
-		Pending:   make([]PendingTransactionSummary, 0),
+		Confirmed:  make([]ConfirmedTransactionSummary, 0),
+		Pending:    make([]PendingTransactionSummary, 0),
+		NextCursor: nextCursor,
 	}
 
 	for _, transaction := range transactions {
@@ -171,6 +521,8 @@ func (s *PosService) ListTransactionsByPos(ctx context.Context, vendorID uint, p
 			Amount:    transaction.Amount,
 			Accepted:  transaction.Accepted,
 			Confirmed: transaction.Confirmed,
+			Status:    transaction.Status,
+			ExpiresAt: transaction.ExpiresAt,
 		})
 	}
 
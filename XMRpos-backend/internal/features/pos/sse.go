@@ -0,0 +1,168 @@
+package pos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+const (
+	sseHeartbeatPeriod = 15 * time.Second
+	sseWriteTimeout    = 5 * time.Second
+)
+
+// TransactionSSE streams the same transaction updates as TransactionWS as Server-Sent Events.
+// Event IDs are the transaction sequence: a reconnect with Last-Event-ID (or ?since=) at the
+// current state sends nothing until the next change, otherwise the stream opens with the current
+// transaction. A comment is sent every 15 seconds to keep proxies from timing out.
+// An EventSource authorizes with ?ticket= from CreateStreamTicket, other clients with their token.
+func (h *PosHandler) TransactionSSE(w http.ResponseWriter, r *http.Request) {
+	var transactionID uint
+	var ok bool
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		transactionID, ok = h.authorizeStreamTicket(w, r, ticket)
+	} else {
+		transactionID, _, _, ok = h.authorizeTransactionStream(w, r)
+	}
+	if !ok {
+		return
+	}
+	version, since, ok := streamOptions(w, r)
+	if !ok {
+		return
+	}
+
+	sub := hub.subscribe(transactionID)
+	defer hub.unsubscribe(sub)
+
+	snapshot, err := h.currentState(r.Context(), transactionID, since)
+	if err != nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server write timeout would cut the stream, every write sets its own deadline instead
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(chunk string) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	lastSent := since
+	send := func(eventType string, transaction *models.Transaction) bool {
+		data, err := encodeTransaction(version, eventType, transaction)
+		if err != nil {
+			return false
+		}
+		lastSent = TransactionSequence(transaction)
+		return write(fmt.Sprintf("id: %d\nevent: transaction\ndata: %s\n\n", lastSent, data))
+	}
+
+	if !write("retry: 3000\n\n") {
+		return
+	}
+	if snapshot != nil && !send(TransactionEventSnapshot, snapshot) {
+		return
+	}
+
+	ticker := time.NewTicker(sseHeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case transaction, open := <-sub.updates:
+			if !open {
+				// Dropped for falling behind, the client reconnects with its Last-Event-ID
+				return
+			}
+			if TransactionSequence(transaction) <= lastSent {
+				continue // already covered by the snapshot
+			}
+			if !send(TransactionEventUpdate, transaction) {
+				return
+			}
+		case <-ticker.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		}
+	}
+}
+
+// CreateStreamTicket hands out a ticket to open TransactionSSE for ?transaction_id= without an Authorization header
+func (h *PosHandler) CreateStreamTicket(w http.ResponseWriter, r *http.Request) {
+	transactionID, vendorID, posID, ok := h.authorizeTransactionStream(w, r)
+	if !ok {
+		return
+	}
+
+	ticket, httpErr := h.service.CreateStreamTicket(vendorID, posID, transactionID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ticket)
+}
+
+// authorizeStreamTicket checks a stream ticket and that its POS may still follow the transaction, writing the error otherwise.
+// The automatic reconnect of an EventSource sends Last-Event-ID, it may resume with a ticket that expired meanwhile.
+func (h *PosHandler) authorizeStreamTicket(w http.ResponseWriter, r *http.Request, ticket string) (transactionID uint, ok bool) {
+	resume := r.Header.Get("Last-Event-ID") != ""
+	claims, err := h.service.parseStreamTicket(ticket, resume)
+	if err != nil {
+		http.Error(w, "Invalid ticket: "+err.Error(), http.StatusUnauthorized)
+		return 0, false
+	}
+	if value := r.URL.Query().Get("transaction_id"); value != "" && value != strconv.FormatUint(uint64(claims.TransactionID), 10) {
+		http.Error(w, "Ticket is for another transaction", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if resume {
+		exists, err := h.service.repo.PosExists(ctx, claims.VendorID, claims.PosID)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
+		if !exists {
+			http.Error(w, "POS no longer exists", http.StatusUnauthorized)
+			return 0, false
+		}
+	}
+	transaction, err := h.service.repo.FindTransactionByID(ctx, claims.TransactionID)
+	if err != nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return 0, false
+	}
+	if !h.service.IsAuthorizedForTransaction(claims.VendorID, claims.PosID, transaction) {
+		http.Error(w, "Unauthorized for this transaction", http.StatusUnauthorized)
+		return 0, false
+	}
+	return claims.TransactionID, true
+}
@@ -0,0 +1,81 @@
+package pos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// A stream ticket lets an EventSource, which cannot send an Authorization header, follow one transaction.
+// It is only good for opening the stream, so it is short-lived and a client fetches a new one to reconnect.
+const streamTicketLifetime = time.Minute
+
+// An EventSource reconnects on its own with the URL it was opened with, so an expired ticket still resumes
+// the stream (a request carrying Last-Event-ID) this long after it expired, as long as its POS exists.
+const streamTicketResumeGrace = time.Hour
+
+type StreamTicket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type streamTicketClaims struct {
+	TransactionID uint `json:"transaction_id"`
+	VendorID      uint `json:"vendor_id"`
+	PosID         uint `json:"pos_id"`
+	jwt.RegisteredClaims
+}
+
+// streamTicketKey is derived from the access token secret, so that a ticket never passes as an access token
+func (s *PosService) streamTicketKey() []byte {
+	mac := hmac.New(sha256.New, []byte(s.config.JWTSecret))
+	mac.Write([]byte("transaction stream ticket"))
+	return mac.Sum(nil)
+}
+
+// CreateStreamTicket signs a ticket for a transaction the POS is already authorized for
+func (s *PosService) CreateStreamTicket(vendorID uint, posID uint, transactionID uint) (*StreamTicket, *models.HTTPError) {
+	expiresAt := time.Now().Add(streamTicketLifetime)
+	ticketJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, streamTicketClaims{
+		TransactionID: transactionID,
+		VendorID:      vendorID,
+		PosID:         posID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+
+	ticket, err := ticketJWT.SignedString(s.streamTicketKey())
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to sign stream ticket: "+err.Error())
+	}
+	return &StreamTicket{Ticket: ticket, ExpiresAt: expiresAt}, nil
+}
+
+// parseStreamTicket checks the signature and expiry of a ticket, resume extends the expiry by streamTicketResumeGrace
+func (s *PosService) parseStreamTicket(ticket string, resume bool) (*streamTicketClaims, error) {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if resume {
+		options = append(options, jwt.WithLeeway(streamTicketResumeGrace))
+	}
+
+	claims := &streamTicketClaims{}
+	token, err := jwt.ParseWithClaims(ticket, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return s.streamTicketKey(), nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid ticket")
+	}
+	return claims, nil
+}
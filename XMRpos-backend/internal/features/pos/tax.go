@@ -0,0 +1,41 @@
+package pos
+
+import (
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// taxBreakdown splits the fiat sale amount into net, tax and gross
+type taxBreakdown struct {
+	RateID    *uint
+	Name      *string
+	Rate      *float64
+	Inclusive bool
+	Net       float64
+	Tax       float64
+	Gross     float64
+}
+
+// computeTax applies taxRate to price, which is gross when inclusive and net otherwise. A nil taxRate means no tax.
+func computeTax(price float64, taxRate *models.TaxRate, inclusive bool) taxBreakdown {
+	price = roundFiat(price)
+	if taxRate == nil {
+		return taxBreakdown{Inclusive: inclusive, Net: price, Gross: price}
+	}
+
+	result := taxBreakdown{
+		RateID:    &taxRate.ID,
+		Name:      &taxRate.Name,
+		Rate:      &taxRate.Rate,
+		Inclusive: inclusive,
+	}
+	if inclusive {
+		result.Gross = price
+		result.Net = roundFiat(price * 100 / (100 + taxRate.Rate))
+		result.Tax = roundFiat(result.Gross - result.Net)
+	} else {
+		result.Net = price
+		result.Tax = roundFiat(price * taxRate.Rate / 100)
+		result.Gross = roundFiat(result.Net + result.Tax)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package pos
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/rates"
+)
+
+const maxTipPercentage = 100
+
+// tipBreakdown is the tip added on top of the sale, in both XMR and fiat
+type tipBreakdown struct {
+	Type             *string
+	Percentage       *float64
+	Amount           int64
+	AmountInCurrency float64
+}
+
+// computeTip works out the tip from a percentage of the sale or a fixed amount.
+// A fixed tip given in only one unit is converted at the exchange rate, or at the ratio of the sale amounts without one.
+func computeTip(params CreateTransactionParams, amount int64, rate *rates.Rate, ratesService *rates.RatesService) (tipBreakdown, *models.HTTPError) {
+	fixed := params.TipAmount != 0 || params.TipAmountInCurrency != 0
+
+	if params.TipAmount < 0 || params.TipAmountInCurrency < 0 {
+		return tipBreakdown{}, models.NewHTTPError(http.StatusBadRequest, "Tip must not be negative")
+	}
+
+	if params.TipPercentage != nil {
+		if fixed {
+			return tipBreakdown{}, models.NewHTTPError(http.StatusBadRequest, "Tip must be either a percentage or a fixed amount")
+		}
+		percentage := *params.TipPercentage
+		if percentage <= 0 || percentage > maxTipPercentage {
+			return tipBreakdown{}, models.NewHTTPError(http.StatusBadRequest, "Tip percentage must be above 0 and at most 100")
+		}
+		tipType := models.TipTypePercentage
+		return tipBreakdown{
+			Type:             &tipType,
+			Percentage:       &percentage,
+			Amount:           int64(math.Round(float64(amount) * percentage / 100)),
+			AmountInCurrency: roundFiat(params.AmountInCurrency * percentage / 100),
+		}, nil
+	}
+
+	if !fixed {
+		return tipBreakdown{}, nil
+	}
+
+	result := tipBreakdown{Amount: params.TipAmount, AmountInCurrency: params.TipAmountInCurrency}
+	tipType := models.TipTypeFixed
+	result.Type = &tipType
+
+	switch {
+	case result.Amount == 0 && rate != nil:
+		result.Amount = rates.FiatToAtomic(result.AmountInCurrency, rate.Rate)
+	case result.Amount == 0 && params.AmountInCurrency > 0:
+		result.Amount = int64(math.Round(float64(amount) * result.AmountInCurrency / params.AmountInCurrency))
+	case result.Amount == 0:
+		return tipBreakdown{}, models.NewHTTPError(http.StatusBadRequest, "Exchange rate unavailable, tip_amount is required")
+	case result.AmountInCurrency == 0 && rate != nil:
+		result.AmountInCurrency = roundFiat(float64(result.Amount) / rates.AtomicUnitsPerXMR * rate.Rate)
+	case result.AmountInCurrency == 0 && amount > 0:
+		result.AmountInCurrency = roundFiat(params.AmountInCurrency * float64(result.Amount) / float64(amount))
+	case rate != nil && !ratesService.WithinTolerance(result.Amount, result.AmountInCurrency, rate.Rate):
+		return tipBreakdown{}, models.NewHTTPError(http.StatusBadRequest, "Tip amount does not match tip_amount_in_currency at the current exchange rate")
+	}
+
+	return result, nil
+}
+
+func roundFiat(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,153 @@
+package pos
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// Types of the events on the vendor feed
+const (
+	VendorEventTransactionCreated     = "transaction.created"
+	VendorEventTransactionUpdated     = "transaction.updated" // a payment was seen or the transaction was resolved, without a status change
+	VendorEventTransactionConfirmed   = "transaction.confirmed"
+	VendorEventTransactionDoubleSpend = "transaction.double_spend" // a payment was reported double-spent, acceptance is revoked and the sale awaits review
+	VendorEventTransactionReorg       = "transaction.reorg"        // a mined payment vanished or moved to another block, payouts wait until it is confirmed again
+	VendorEventTransferCompleted      = "transfer.completed"
+)
+
+// VendorEvent is one message on the vendor feed. Status changes are typed "transaction.<status>",
+// e.g. transaction.paid, transaction.underpaid, transaction.expired or transaction.cancelled.
+type VendorEvent struct {
+	Type        string              `json:"type"`
+	Time        time.Time           `json:"time"`
+	Transaction *models.Transaction `json:"transaction,omitempty"`
+	Transfer    *TransferEvent      `json:"transfer,omitempty"`
+}
+
+type TransferEvent struct {
+	ID                uint    `json:"id"`
+	Amount            int64   `json:"amount"`
+	AmountTransferred *int64  `json:"amount_transferred"`
+	TxHash            *string `json:"tx_hash"`
+	TransactionIDs    []uint  `json:"transaction_ids"`
+}
+
+type vendorClient struct {
+	conn  *websocket.Conn
+	posID uint       // set for a POS, which only gets the events of its own transactions
+	mu    sync.Mutex // gorilla connections allow one writer at a time
+}
+
+type vendorHub struct {
+	clients map[uint][]*vendorClient // vendorID -> clients
+	mu      sync.Mutex
+}
+
+var vendorFeed = vendorHub{
+	clients: make(map[uint][]*vendorClient),
+}
+
+// TransactionEventTypes lists the vendor feed events for a transaction that was previousStatus and previousConfirmed
+func TransactionEventTypes(previousStatus string, previousConfirmed bool, transaction *models.Transaction) []string {
+	var eventTypes []string
+	if transaction.Status != previousStatus {
+		eventTypes = append(eventTypes, "transaction."+transaction.Status)
+	}
+	if transaction.Confirmed && !previousConfirmed {
+		eventTypes = append(eventTypes, VendorEventTransactionConfirmed)
+	}
+	if len(eventTypes) == 0 {
+		eventTypes = append(eventTypes, VendorEventTransactionUpdated)
+	}
+	return eventTypes
+}
+
+// deliverVendorEvent sends event to every feed connection of the vendor on this instance
+func deliverVendorEvent(vendorID uint, event VendorEvent) {
+	vendorFeed.mu.Lock()
+	clients := append([]*vendorClient(nil), vendorFeed.clients[vendorID]...)
+	vendorFeed.mu.Unlock()
+
+	for _, client := range clients {
+		if client.posID != 0 && (event.Transaction == nil || event.Transaction.PosID != client.posID) {
+			continue
+		}
+		client.mu.Lock()
+		// prevent a slow client from blocking others
+		_ = client.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := client.conn.WriteJSON(event); err != nil {
+			_ = client.conn.Close()
+		}
+		client.mu.Unlock()
+	}
+}
+
+// closeAll disconnects every feed on this instance, its clients reconnect and reload what they show
+func (h *vendorHub) closeAll(reason string) {
+	h.mu.Lock()
+	var clients []*vendorClient
+	for _, vendorClients := range h.clients {
+		clients = append(clients, vendorClients...)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.mu.Lock()
+		_ = client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason), time.Now().Add(5*time.Second))
+		_ = client.conn.Close()
+		client.mu.Unlock()
+	}
+}
+
+// ServeVendorFeed upgrades the request and streams the events of vendorID until the connection closes.
+// The caller checks that the token belongs to the vendor.
+func ServeVendorFeed(w http.ResponseWriter, r *http.Request, vendorID uint) {
+	serveFeed(w, r, vendorID, 0)
+}
+
+// EventsWS streams the vendor feed events about the transactions of the calling POS, such as
+// transaction.double_spend alerts for sales it already handed over.
+func (h *PosHandler) EventsWS(w http.ResponseWriter, r *http.Request) {
+	vendorID, posID, ok := posIDs(w, r)
+	if !ok {
+		return
+	}
+	serveFeed(w, r, vendorID, posID)
+}
+
+func serveFeed(w http.ResponseWriter, r *http.Request, vendorID uint, posID uint) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("vendor websocket upgrade failed (vendorID=%d): %v", vendorID, err)
+		return
+	}
+
+	client := &vendorClient{conn: conn, posID: posID}
+
+	vendorFeed.mu.Lock()
+	vendorFeed.clients[vendorID] = append(vendorFeed.clients[vendorID], client)
+	vendorFeed.mu.Unlock()
+
+	defer func() {
+		vendorFeed.mu.Lock()
+		clients := vendorFeed.clients[vendorID]
+		for i, c := range clients {
+			if c == client {
+				vendorFeed.clients[vendorID] = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+		if len(vendorFeed.clients[vendorID]) == 0 {
+			delete(vendorFeed.clients, vendorID)
+		}
+		vendorFeed.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	keepAlive(r, conn)
+}
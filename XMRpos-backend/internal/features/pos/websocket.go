@@ -5,7 +5,6 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -13,16 +12,6 @@ import (
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
 )
 
-type wsClient struct {
-	conn          *websocket.Conn
-	transactionID uint
-}
-
-type wsHub struct {
-	clients map[uint][]*wsClient // transactionID -> clients
-	mu      sync.Mutex
-}
-
 func uintFromClaim(claim interface{}) (uint, bool) {
 	switch v := claim.(type) {
 	case uint:
@@ -60,24 +49,20 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-var hub = wsHub{
-	clients: make(map[uint][]*wsClient),
-}
-
-// WebSocket handler for subscribing to transaction updates
-func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
+// authorizeTransactionStream resolves ?transaction_id= and checks the POS token may follow it, writing the error otherwise
+func (h *PosHandler) authorizeTransactionStream(w http.ResponseWriter, r *http.Request) (transactionID uint, vendorID uint, posID uint, ok bool) {
 	transactionIDStr := r.URL.Query().Get("transaction_id")
 	if transactionIDStr == "" {
 		http.Error(w, "Missing transaction_id query parameter", http.StatusBadRequest)
-		return
+		return 0, 0, 0, false
 	}
 
 	transactionID64, err := strconv.ParseUint(transactionIDStr, 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid transaction_id", http.StatusBadRequest)
-		return
+		return 0, 0, 0, false
 	}
-	TransactionID := uint(transactionID64)
+	transactionID = uint(transactionID64)
 	// bound auth + repo checks
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -87,37 +72,51 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 	role, _ := roleClaim.(string)
 	if !ok || role != "pos" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, 0, 0, false
 	}
 	vendorClaim, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, 0, 0, false
 	}
-	vendorID, ok := uintFromClaim(vendorClaim)
+	vendorID, ok = uintFromClaim(vendorClaim)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, 0, 0, false
 	}
 	posClaim, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsPosIDKey)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, 0, 0, false
 	}
-	posID, ok := uintFromClaim(posClaim)
+	posID, ok = uintFromClaim(posClaim)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, 0, 0, false
 	}
 
-	transaction, err := h.service.repo.FindTransactionByID(ctx, TransactionID)
+	transaction, err := h.service.repo.FindTransactionByID(ctx, transactionID)
 	if err != nil {
 		http.Error(w, "Transaction not found", http.StatusNotFound)
-		return
+		return 0, 0, 0, false
 	}
 
 	if !h.service.IsAuthorizedForTransaction(vendorID, posID, transaction) {
 		http.Error(w, "Unauthorized for this transaction", http.StatusUnauthorized)
+		return 0, 0, 0, false
+	}
+	return transactionID, vendorID, posID, true
+}
+
+// WebSocket handler for subscribing to transaction updates
+func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
+	TransactionID, vendorID, posID, ok := h.authorizeTransactionStream(w, r)
+	if !ok {
+		return
+	}
+
+	version, since, ok := streamOptions(w, r)
+	if !ok {
 		return
 	}
 
@@ -127,6 +126,59 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to upgrade websocket connection: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	defer conn.Close()
+
+	sub := hub.subscribe(TransactionID)
+	defer hub.unsubscribe(sub)
+
+	// Versioned clients start from the current state, the original protocol only sends changes
+	var lastSent int64
+	var snapshot *models.Transaction
+	if version > 0 {
+		snapshot, err = h.currentState(r.Context(), TransactionID, since)
+		if err != nil {
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "transaction not found"), time.Now().Add(5*time.Second))
+			return
+		}
+		lastSent = since
+	}
+
+	// A single writer, gorilla connections do not support concurrent writes
+	go func() {
+		send := func(eventType string, transaction *models.Transaction) bool {
+			data, err := encodeTransaction(version, eventType, transaction)
+			if err != nil {
+				return false
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			return conn.WriteMessage(websocket.TextMessage, data) == nil
+		}
+		if snapshot != nil {
+			if !send(TransactionEventSnapshot, snapshot) {
+				_ = conn.Close()
+				return
+			}
+			lastSent = TransactionSequence(snapshot)
+		}
+		for transaction := range sub.updates {
+			if version > 0 && TransactionSequence(transaction) <= lastSent {
+				continue // already covered by the snapshot
+			}
+			if !send(TransactionEventUpdate, transaction) {
+				_ = conn.Close()
+				return
+			}
+			lastSent = TransactionSequence(transaction)
+		}
+		// Dropped for falling behind, the client reconnects with its last sequence
+		_ = conn.Close()
+	}()
+
+	keepAlive(r, conn)
+}
+
+// keepAlive pings conn and drains its reads until the peer goes away or the request ends
+func keepAlive(r *http.Request, conn *websocket.Conn) {
 	// websocket I/O limits to prevent hangs
 	const (
 		pongWait   = 60 * time.Second
@@ -136,28 +188,6 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(pongWait)) })
 	conn.SetReadLimit(1 << 20) // 1MB
 
-	client := &wsClient{conn: conn, transactionID: TransactionID}
-
-	hub.mu.Lock()
-	hub.clients[TransactionID] = append(hub.clients[TransactionID], client)
-	hub.mu.Unlock()
-
-	defer func() {
-		hub.mu.Lock()
-		clients := hub.clients[TransactionID]
-		for i, c := range clients {
-			if c == client {
-				hub.clients[TransactionID] = append(clients[:i], clients[i+1:]...)
-				break
-			}
-		}
-		if len(hub.clients[TransactionID]) == 0 {
-			delete(hub.clients, TransactionID)
-		}
-		hub.mu.Unlock()
-		_ = conn.Close()
-	}()
-
 	// ping to detect dead peers
 	ticker := time.NewTicker(pingPeriod)
 	defer ticker.Stop()
@@ -178,20 +208,4 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-
-}
-
-// Call this when a transaction is updated
-func NotifyTransactionUpdate(transactionID uint, update interface{}) {
-	hub.mu.Lock()
-	clients := hub.clients[transactionID]
-	hub.mu.Unlock()
-
-	for _, client := range clients {
-		// prevent a slow client from blocking others
-		_ = client.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-		if err := client.conn.WriteJSON(update); err != nil {
-			_ = client.conn.Close()
-		}
-	}
 }
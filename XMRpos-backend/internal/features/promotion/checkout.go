@@ -0,0 +1,97 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// ErrUnavailable is returned by Redeem when the promotion changed, ran out or ended after it was priced
+var ErrUnavailable = errors.New("promotion is no longer available")
+
+// Discount prices a promotion for a sale of price in currency made on posID. The promotion must be loaded with its Pos.
+func Discount(promotion *models.Promotion, posID uint, price float64, currency string, now time.Time) (float64, *models.HTTPError) {
+	if !promotion.Active {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "Discount code is not active")
+	}
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "Discount code is not valid yet")
+	}
+	if promotion.EndsAt != nil && !now.Before(*promotion.EndsAt) {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "Discount code has ended")
+	}
+	if promotion.MaxUses != nil && promotion.Uses >= *promotion.MaxUses {
+		return 0, models.NewHTTPError(http.StatusConflict, "Discount code has been used up")
+	}
+	if len(promotion.Pos) > 0 {
+		allowed := false
+		for _, p := range promotion.Pos {
+			if p.ID == posID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return 0, models.NewHTTPError(http.StatusBadRequest, "Discount code is not valid on this POS")
+		}
+	}
+
+	if price <= 0 {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "amount_in_currency is required to apply a discount code")
+	}
+	if promotion.Currency != nil && *promotion.Currency != currency {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "Discount code is only valid for sales in "+*promotion.Currency)
+	}
+	if promotion.MinSpend != nil && price < *promotion.MinSpend {
+		return 0, models.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Discount code requires a minimum spend of %.2f %s", *promotion.MinSpend, currency))
+	}
+
+	var discount float64
+	switch promotion.Type {
+	case models.PromotionTypePercentage:
+		discount = math.Round(price*promotion.Value) / 100
+	default:
+		discount = promotion.Value
+	}
+	if discount >= price {
+		return 0, models.NewHTTPError(http.StatusBadRequest, "Discount must be less than the sale amount")
+	}
+	return discount, nil
+}
+
+// Redeem counts a use of the promotion inside the caller's database transaction. It only succeeds while the promotion
+// is still usable and unchanged since updatedAt, so concurrent sales cannot go past MaxUses or use a stale price.
+func Redeem(tx *gorm.DB, promotionID uint, updatedAt time.Time, now time.Time) error {
+	result := tx.Model(&models.Promotion{}).
+		Where("id = ? AND active = ? AND updated_at = ?", promotionID, true, updatedAt).
+		Where("max_uses IS NULL OR uses < max_uses").
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", now, now).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Release gives back the use taken by a transaction that will not be paid
+func Release(tx *gorm.DB, transactionID uint) error {
+	var transaction models.Transaction
+	if err := tx.Select("id", "promotion_id").First(&transaction, transactionID).Error; err != nil {
+		return err
+	}
+	if transaction.PromotionID == nil {
+		return nil
+	}
+	// Unscoped so a deleted promotion still gets its count right
+	return tx.Unscoped().Model(&models.Promotion{}).
+		Where("id = ? AND uses > 0", *transaction.PromotionID).
+		UpdateColumn("uses", gorm.Expr("uses - 1")).Error
+}
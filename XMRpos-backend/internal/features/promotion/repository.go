@@ -0,0 +1,156 @@
+package promotion
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// Columns written on update, listed so that cleared optional fields are written too
+var promotionColumns = []string{
+	"code", "name", "type", "value", "currency", "min_spend", "starts_at", "ends_at", "max_uses", "active",
+}
+
+type PromotionRepository interface {
+	ListPromotions(ctx context.Context, vendorID uint) ([]*models.Promotion, error)
+	FindPromotion(ctx context.Context, vendorID uint, id uint) (*models.Promotion, error)
+	CodeExists(ctx context.Context, vendorID uint, code string, excludeID uint) (bool, error)
+	CountPosForVendor(ctx context.Context, vendorID uint, posIDs []uint) (int64, error)
+	CreatePromotion(ctx context.Context, promotion *models.Promotion, posIDs []uint) error
+	UpdatePromotion(ctx context.Context, promotion *models.Promotion, posIDs *[]uint) error
+	DeletePromotion(ctx context.Context, vendorID uint, id uint) error
+}
+
+type promotionRepository struct {
+	db *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) PromotionRepository {
+	return &promotionRepository{db: db}
+}
+
+func (r *promotionRepository) ListPromotions(ctx context.Context, vendorID uint) ([]*models.Promotion, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var promotions []*models.Promotion
+	if err := r.db.WithContext(ctx).
+		Preload("Pos").
+		Where("vendor_id = ?", vendorID).
+		Order("code ASC").
+		Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+func (r *promotionRepository) FindPromotion(ctx context.Context, vendorID uint, id uint) (*models.Promotion, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var promotion models.Promotion
+	if err := r.db.WithContext(ctx).
+		Preload("Pos").
+		Where("id = ? AND vendor_id = ?", id, vendorID).
+		First(&promotion).Error; err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (r *promotionRepository) CodeExists(ctx context.Context, vendorID uint, code string, excludeID uint) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Promotion{}).
+		Where("vendor_id = ? AND code = ? AND id <> ?", vendorID, code, excludeID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *promotionRepository) CountPosForVendor(ctx context.Context, vendorID uint, posIDs []uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Pos{}).
+		Where("vendor_id = ? AND id IN ?", vendorID, posIDs).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func posRefs(posIDs []uint) []models.Pos {
+	refs := make([]models.Pos, 0, len(posIDs))
+	for _, id := range posIDs {
+		refs = append(refs, models.Pos{Model: gorm.Model{ID: id}})
+	}
+	return refs
+}
+
+func (r *promotionRepository) CreatePromotion(ctx context.Context, promotion *models.Promotion, posIDs []uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Pos").Create(promotion).Error; err != nil {
+			return err
+		}
+		// Create skips false booleans in favour of the column default
+		if !promotion.Active {
+			if err := tx.Model(promotion).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		if len(posIDs) == 0 {
+			return nil
+		}
+		return tx.Model(promotion).Omit("Pos.*").Association("Pos").Replace(posRefs(posIDs))
+	})
+}
+
+// UpdatePromotion writes every editable field, and replaces the POS restriction when posIDs is set
+func (r *promotionRepository) UpdatePromotion(ctx context.Context, promotion *models.Promotion, posIDs *[]uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(promotion).
+			Where("vendor_id = ?", promotion.VendorID).
+			Select(promotionColumns).
+			Updates(promotion)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if posIDs == nil {
+			return nil
+		}
+		if len(*posIDs) == 0 {
+			return tx.Model(promotion).Association("Pos").Clear()
+		}
+		return tx.Model(promotion).Omit("Pos.*").Association("Pos").Replace(posRefs(*posIDs))
+	})
+}
+
+// DeletePromotion soft deletes the promotion, transactions keep the code they were sold with
+func (r *promotionRepository) DeletePromotion(ctx context.Context, vendorID uint, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Where("id = ? AND vendor_id = ?", id, vendorID).Delete(&models.Promotion{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
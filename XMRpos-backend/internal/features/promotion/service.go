@@ -0,0 +1,289 @@
+package promotion
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const maxNameLength = 255
+
+var (
+	codeRegex     = regexp.MustCompile("^[A-Z0-9_-]{3,32}$")
+	currencyRegex = regexp.MustCompile("^[A-Z]{3}$")
+)
+
+type PromotionService struct {
+	repo PromotionRepository
+}
+
+func NewPromotionService(repo PromotionRepository) *PromotionService {
+	return &PromotionService{repo: repo}
+}
+
+type PromotionSummary struct {
+	ID        uint       `json:"id"`
+	Code      string     `json:"code"`
+	Name      *string    `json:"name"`
+	Type      string     `json:"type"`
+	Value     float64    `json:"value"`
+	Currency  *string    `json:"currency"`
+	MinSpend  *float64   `json:"min_spend"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	MaxUses   *int64     `json:"max_uses"`
+	Uses      int64      `json:"uses"`
+	Active    bool       `json:"active"`
+	PosIDs    []uint     `json:"pos_ids"` // Empty when every POS may use the code
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func toPromotionSummary(promotion *models.Promotion) PromotionSummary {
+	posIDs := make([]uint, 0, len(promotion.Pos))
+	for _, p := range promotion.Pos {
+		posIDs = append(posIDs, p.ID)
+	}
+	return PromotionSummary{
+		ID:        promotion.ID,
+		Code:      promotion.Code,
+		Name:      promotion.Name,
+		Type:      promotion.Type,
+		Value:     promotion.Value,
+		Currency:  promotion.Currency,
+		MinSpend:  promotion.MinSpend,
+		StartsAt:  promotion.StartsAt,
+		EndsAt:    promotion.EndsAt,
+		MaxUses:   promotion.MaxUses,
+		Uses:      promotion.Uses,
+		Active:    promotion.Active,
+		PosIDs:    posIDs,
+		UpdatedAt: promotion.UpdatedAt,
+	}
+}
+
+// NormalizeCode is how codes are stored and looked up, customers may type them in any case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PromotionParams holds the fields to set, nil fields are left untouched. Empty strings clear the optional
+// text and date fields, a min_spend or max_uses of 0 removes the limit and an empty pos_ids allows every POS.
+type PromotionParams struct {
+	Code     *string  `json:"code"`
+	Name     *string  `json:"name"`
+	Type     *string  `json:"type"`
+	Value    *float64 `json:"value"`
+	Currency *string  `json:"currency"`
+	MinSpend *float64 `json:"min_spend"`
+	StartsAt *string  `json:"starts_at"` // RFC3339
+	EndsAt   *string  `json:"ends_at"`   // RFC3339, exclusive
+	MaxUses  *int64   `json:"max_uses"`
+	PosIDs   *[]uint  `json:"pos_ids"`
+	Active   *bool    `json:"active"`
+}
+
+func (s *PromotionService) ListPromotions(ctx context.Context, vendorID uint) ([]PromotionSummary, *models.HTTPError) {
+	promotions, err := s.repo.ListPromotions(ctx, vendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summaries := make([]PromotionSummary, 0, len(promotions))
+	for _, promotion := range promotions {
+		summaries = append(summaries, toPromotionSummary(promotion))
+	}
+	return summaries, nil
+}
+
+func (s *PromotionService) CreatePromotion(ctx context.Context, vendorID uint, params PromotionParams) (*PromotionSummary, *models.HTTPError) {
+	if params.Code == nil || params.Type == nil || params.Value == nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "code, type and value are required")
+	}
+
+	promotion := &models.Promotion{VendorID: vendorID, Active: true}
+	if httpErr := s.applyParams(ctx, promotion, params); httpErr != nil {
+		return nil, httpErr
+	}
+
+	var posIDs []uint
+	if params.PosIDs != nil {
+		posIDs = *params.PosIDs
+	}
+	if err := s.repo.CreatePromotion(ctx, promotion, posIDs); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	return s.getPromotion(ctx, vendorID, promotion.ID)
+}
+
+// UpdatePromotion edits a promotion, sales that priced the old version before the edit fail to redeem it
+func (s *PromotionService) UpdatePromotion(ctx context.Context, vendorID uint, id uint, params PromotionParams) (*PromotionSummary, *models.HTTPError) {
+	promotion, err := s.repo.FindPromotion(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "promotion not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	if httpErr := s.applyParams(ctx, promotion, params); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if err := s.repo.UpdatePromotion(ctx, promotion, params.PosIDs); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "promotion not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	return s.getPromotion(ctx, vendorID, id)
+}
+
+func (s *PromotionService) DeletePromotion(ctx context.Context, vendorID uint, id uint) *models.HTTPError {
+	if err := s.repo.DeletePromotion(ctx, vendorID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.NewHTTPError(http.StatusNotFound, "promotion not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	return nil
+}
+
+func (s *PromotionService) getPromotion(ctx context.Context, vendorID uint, id uint) (*PromotionSummary, *models.HTTPError) {
+	promotion, err := s.repo.FindPromotion(ctx, vendorID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "promotion not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+	summary := toPromotionSummary(promotion)
+	return &summary, nil
+}
+
+// applyParams sets params on promotion and validates the resulting rule as a whole
+func (s *PromotionService) applyParams(ctx context.Context, promotion *models.Promotion, params PromotionParams) *models.HTTPError {
+	if params.Code != nil {
+		code := NormalizeCode(*params.Code)
+		if !codeRegex.MatchString(code) {
+			return models.NewHTTPError(http.StatusBadRequest, "code must be 3 to 32 letters, digits, '-' or '_'")
+		}
+		exists, err := s.repo.CodeExists(ctx, promotion.VendorID, code, promotion.ID)
+		if err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+		if exists {
+			return models.NewHTTPError(http.StatusConflict, "code is already in use")
+		}
+		promotion.Code = code
+	}
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if len(name) > maxNameLength {
+			return models.NewHTTPError(http.StatusBadRequest, "name must be at most 255 characters")
+		}
+		promotion.Name = nil
+		if name != "" {
+			promotion.Name = &name
+		}
+	}
+	if params.Type != nil {
+		promotion.Type = *params.Type
+	}
+	if params.Value != nil {
+		promotion.Value = *params.Value
+	}
+	if params.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*params.Currency))
+		promotion.Currency = nil
+		if currency != "" {
+			if !currencyRegex.MatchString(currency) {
+				return models.NewHTTPError(http.StatusBadRequest, "currency must be a 3 letter code")
+			}
+			promotion.Currency = &currency
+		}
+	}
+	if params.MinSpend != nil {
+		if *params.MinSpend < 0 {
+			return models.NewHTTPError(http.StatusBadRequest, "min_spend must not be negative")
+		}
+		promotion.MinSpend = nil
+		if *params.MinSpend > 0 {
+			promotion.MinSpend = params.MinSpend
+		}
+	}
+	for _, field := range []struct {
+		name   string
+		value  *string
+		target **time.Time
+	}{
+		{"starts_at", params.StartsAt, &promotion.StartsAt},
+		{"ends_at", params.EndsAt, &promotion.EndsAt},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value == "" {
+			*field.target = nil
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			return models.NewHTTPError(http.StatusBadRequest, field.name+" must be an RFC3339 timestamp")
+		}
+		*field.target = &parsed
+	}
+	if params.MaxUses != nil {
+		if *params.MaxUses < 0 {
+			return models.NewHTTPError(http.StatusBadRequest, "max_uses must not be negative")
+		}
+		promotion.MaxUses = nil
+		if *params.MaxUses > 0 {
+			promotion.MaxUses = params.MaxUses
+		}
+	}
+	if params.Active != nil {
+		promotion.Active = *params.Active
+	}
+	if params.PosIDs != nil && len(*params.PosIDs) > 0 {
+		unique := make(map[uint]bool, len(*params.PosIDs))
+		for _, id := range *params.PosIDs {
+			unique[id] = true
+		}
+		count, err := s.repo.CountPosForVendor(ctx, promotion.VendorID, *params.PosIDs)
+		if err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+		}
+		if count != int64(len(unique)) {
+			return models.NewHTTPError(http.StatusBadRequest, "pos_ids must be POS devices of this vendor")
+		}
+	}
+
+	switch promotion.Type {
+	case models.PromotionTypePercentage:
+		if promotion.Value <= 0 || promotion.Value >= 100 {
+			return models.NewHTTPError(http.StatusBadRequest, "value must be above 0 and below 100 for a percentage")
+		}
+	case models.PromotionTypeFixed:
+		if promotion.Value <= 0 {
+			return models.NewHTTPError(http.StatusBadRequest, "value must be positive")
+		}
+		if promotion.Currency == nil {
+			return models.NewHTTPError(http.StatusBadRequest, "currency is required for a fixed discount")
+		}
+	default:
+		return models.NewHTTPError(http.StatusBadRequest, "type must be percentage or fixed")
+	}
+	if promotion.MinSpend != nil && promotion.Currency == nil {
+		return models.NewHTTPError(http.StatusBadRequest, "currency is required with min_spend")
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return models.NewHTTPError(http.StatusBadRequest, "ends_at must be after starts_at")
+	}
+	return nil
+}
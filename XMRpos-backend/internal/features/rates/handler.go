@@ -0,0 +1,38 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RatesHandler struct {
+	service *RatesService
+}
+
+func NewRatesHandler(service *RatesService) *RatesHandler {
+	return &RatesHandler{service: service}
+}
+
+func (h *RatesHandler) GetRate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	if !h.service.Enabled() {
+		http.Error(w, "Exchange rates are not configured", http.StatusNotFound)
+		return
+	}
+
+	rate, err := h.service.GetRate(ctx, chi.URLParam(r, "currency"))
+	if err != nil {
+		http.Error(w, "Exchange rate unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rate)
+}
@@ -0,0 +1,119 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/coingecko"
+)
+
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// Provider returns the price of 1 XMR in a fiat currency
+type Provider interface {
+	Name() string
+	GetRate(ctx context.Context, currency string) (float64, error)
+}
+
+// StaticProvider serves a fixed table, e.g. "EUR:150.25,USD:162.10"
+type StaticProvider struct {
+	rates map[string]float64
+}
+
+func NewStaticProvider(table string) (*StaticProvider, error) {
+	rates := make(map[string]float64)
+	for _, entry := range strings.Split(table, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		currency, value, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid static rate entry %q", entry)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid static rate for %s", currency)
+		}
+		rates[normalizeCurrency(currency)] = rate
+	}
+	return &StaticProvider{rates: rates}, nil
+}
+
+func (p *StaticProvider) Name() string {
+	return "static"
+}
+
+func (p *StaticProvider) GetRate(_ context.Context, currency string) (float64, error) {
+	rate, ok := p.rates[currency]
+	if !ok {
+		return 0, ErrRateUnavailable
+	}
+	return rate, nil
+}
+
+// FileProvider reads a JSON object such as {"EUR": 150.25} on every lookup, so the file can be updated while running
+type FileProvider struct {
+	path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+func (p *FileProvider) GetRate(_ context.Context, currency string) (float64, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return 0, err
+	}
+
+	var table map[string]float64
+	if err := json.Unmarshal(data, &table); err != nil {
+		return 0, fmt.Errorf("invalid rates file: %w", err)
+	}
+
+	for key, rate := range table {
+		if normalizeCurrency(key) == currency && rate > 0 {
+			return rate, nil
+		}
+	}
+	return 0, ErrRateUnavailable
+}
+
+// CoinGeckoProvider queries the public CoinGecko API
+type CoinGeckoProvider struct {
+	client *coingecko.CoinGeckoAPIClient
+}
+
+func NewCoinGeckoProvider(client *coingecko.CoinGeckoAPIClient) *CoinGeckoProvider {
+	return &CoinGeckoProvider{client: client}
+}
+
+func (p *CoinGeckoProvider) Name() string {
+	return "coingecko"
+}
+
+func (p *CoinGeckoProvider) GetRate(ctx context.Context, currency string) (float64, error) {
+	prices, err := p.client.GetMoneroPrices(ctx, []string{currency})
+	if err != nil {
+		return 0, err
+	}
+	rate, ok := prices[strings.ToLower(currency)]
+	if !ok || rate <= 0 {
+		return 0, ErrRateUnavailable
+	}
+	return rate, nil
+}
+
+func normalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
@@ -0,0 +1,125 @@
+package rates
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/coingecko"
+)
+
+const AtomicUnitsPerXMR = 1_000_000_000_000
+
+type Rate struct {
+	Currency  string    `json:"currency"`
+	Rate      float64   `json:"rate"` // Price of 1 XMR in the currency
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+type RatesService struct {
+	providers []Provider
+	ttl       time.Duration
+	tolerance float64
+	cache     map[string]Rate
+	mu        sync.Mutex
+}
+
+func NewRatesService(cfg *config.Config) *RatesService {
+	s := &RatesService{
+		ttl:       time.Duration(cfg.RatesCacheTTL) * time.Second,
+		tolerance: cfg.RatesTolerancePercent,
+		cache:     make(map[string]Rate),
+	}
+
+	for _, name := range strings.Split(cfg.RatesProviders, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "":
+			continue
+		case "static":
+			provider, err := NewStaticProvider(cfg.RatesStatic)
+			if err != nil {
+				log.Printf("Invalid RATES_STATIC, static rates disabled: %v", err)
+				continue
+			}
+			s.providers = append(s.providers, provider)
+		case "file":
+			if cfg.RatesFile == "" {
+				log.Println("RATES_FILE not set, file rates disabled")
+				continue
+			}
+			s.providers = append(s.providers, NewFileProvider(cfg.RatesFile))
+		case "coingecko":
+			s.providers = append(s.providers, NewCoinGeckoProvider(coingecko.NewCoinGeckoAPIClient(cfg.CoinGeckoBaseURL, cfg.CoinGeckoAPIKey)))
+		default:
+			log.Printf("Unknown exchange rate provider %q", name)
+		}
+	}
+
+	return s
+}
+
+// Enabled reports whether at least one rate provider is configured
+func (s *RatesService) Enabled() bool {
+	return len(s.providers) > 0
+}
+
+// GetRate returns a cached rate if it is fresh enough, otherwise asks the providers in order
+func (s *RatesService) GetRate(ctx context.Context, currency string) (*Rate, error) {
+	currency = normalizeCurrency(currency)
+	if currency == "" {
+		return nil, fmt.Errorf("currency is required")
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[currency]
+	s.mu.Unlock()
+	if ok && time.Since(cached.FetchedAt) < s.ttl {
+		return &cached, nil
+	}
+
+	var lastErr error = ErrRateUnavailable
+	for _, provider := range s.providers {
+		value, err := provider.GetRate(ctx, currency)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		rate := Rate{
+			Currency:  currency,
+			Rate:      value,
+			Source:    provider.Name(),
+			FetchedAt: time.Now(),
+		}
+		s.mu.Lock()
+		s.cache[currency] = rate
+		s.mu.Unlock()
+		return &rate, nil
+	}
+
+	return nil, lastErr
+}
+
+// FiatToAtomic converts a fiat amount to atomic units at the given rate
+func FiatToAtomic(amountInCurrency float64, rate float64) int64 {
+	if rate <= 0 {
+		return 0
+	}
+	return int64(math.Round(amountInCurrency / rate * AtomicUnitsPerXMR))
+}
+
+// WithinTolerance checks that a client supplied XMR amount matches the fiat amount at the given rate
+func (s *RatesService) WithinTolerance(amount int64, amountInCurrency float64, rate float64) bool {
+	expected := FiatToAtomic(amountInCurrency, rate)
+	if expected <= 0 {
+		return amount <= 0
+	}
+	deviation := math.Abs(float64(amount-expected)) / float64(expected) * 100
+	return deviation <= s.tolerance
+}
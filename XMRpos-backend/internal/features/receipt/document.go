@@ -0,0 +1,239 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+type lineKind int
+
+const (
+	lineText   lineKind = iota // Left aligned, wrapped to the receipt width
+	lineCenter                 // Centered, wrapped to the receipt width
+	linePair                   // Label on the left, value on the right
+	lineRule                   // Horizontal separator
+)
+
+type line struct {
+	kind  lineKind
+	left  string
+	right string
+	bold  bool
+}
+
+// Document is a receipt laid out as lines, every renderer prints the same lines
+type Document struct {
+	Logo  image.Image
+	lines []line
+}
+
+func (d *Document) text(value string) {
+	d.lines = append(d.lines, line{kind: lineText, left: value})
+}
+
+func (d *Document) center(value string, bold bool) {
+	d.lines = append(d.lines, line{kind: lineCenter, left: value, bold: bold})
+}
+
+func (d *Document) pair(left string, right string, bold bool) {
+	d.lines = append(d.lines, line{kind: linePair, left: left, right: right, bold: bold})
+}
+
+func (d *Document) rule() {
+	d.lines = append(d.lines, line{kind: lineRule})
+}
+
+// BuildDocument lays out the receipt of a transaction with the vendor branding
+func BuildDocument(vendor *models.Vendor, pos *models.Pos, transaction *models.Transaction) *Document {
+	doc := &Document{}
+
+	if len(vendor.ReceiptLogo) > 0 {
+		if logo, _, err := image.Decode(bytes.NewReader(vendor.ReceiptLogo)); err == nil {
+			doc.Logo = logo
+		}
+	}
+
+	companyName := vendor.Name
+	if vendor.ReceiptCompanyName != nil {
+		companyName = *vendor.ReceiptCompanyName
+	}
+	doc.center(companyName, true)
+	if vendor.ReceiptHeader != nil {
+		for _, header := range strings.Split(*vendor.ReceiptHeader, "\n") {
+			doc.center(header, false)
+		}
+	}
+	doc.rule()
+
+	doc.pair("Receipt", "#"+strconv.FormatUint(uint64(transaction.ID), 10), false)
+	doc.pair("Date", transaction.CreatedAt.UTC().Format("2006-01-02 15:04")+" UTC", false)
+	if pos != nil {
+		doc.pair("POS", pos.Name, false)
+	}
+	if transaction.Description != nil && *transaction.Description != "" {
+		doc.text(*transaction.Description)
+	}
+	doc.rule()
+
+	if len(transaction.LineItems) > 0 {
+		for _, item := range transaction.LineItems {
+			doc.text(item.Name)
+			doc.pair(fmt.Sprintf("  %d x %.2f", item.Quantity, item.UnitPrice), fmt.Sprintf("%.2f", item.Total), false)
+		}
+		doc.rule()
+	}
+
+	taxLabel := ""
+	if transaction.TaxAmountInCurrency > 0 {
+		taxLabel = "Tax"
+		if transaction.TaxName != nil {
+			taxLabel = *transaction.TaxName
+		}
+		if transaction.TaxRate != nil {
+			taxLabel += " " + strconv.FormatFloat(*transaction.TaxRate, 'f', -1, 64) + "%"
+		}
+	}
+	if transaction.DiscountInCurrency > 0 {
+		discountLabel := "Discount"
+		if transaction.PromotionCode != nil {
+			discountLabel += " " + *transaction.PromotionCode
+		}
+		doc.pair(discountLabel, "-"+formatFiat(transaction.DiscountInCurrency, transaction.Currency), false)
+	}
+	// Exclusive tax is added up before the total, inclusive tax is shown as part of it
+	if taxLabel != "" && !transaction.TaxInclusive {
+		doc.pair("Net", formatFiat(transaction.NetAmountInCurrency, transaction.Currency), false)
+		doc.pair(taxLabel, formatFiat(transaction.TaxAmountInCurrency, transaction.Currency), false)
+	}
+	if transaction.TipAmount > 0 {
+		doc.pair("Subtotal", formatFiat(transaction.AmountInCurrency-transaction.TipAmountInCurrency, transaction.Currency), false)
+		tipLabel := "Tip"
+		if transaction.TipPercentage != nil {
+			tipLabel = "Tip (" + strconv.FormatFloat(*transaction.TipPercentage, 'f', -1, 64) + "%)"
+		}
+		doc.pair(tipLabel, formatFiat(transaction.TipAmountInCurrency, transaction.Currency), false)
+	}
+	doc.pair("Total", formatFiat(transaction.AmountInCurrency, transaction.Currency), true)
+	if taxLabel != "" && transaction.TaxInclusive {
+		doc.pair("Incl. "+taxLabel, formatFiat(transaction.TaxAmountInCurrency, transaction.Currency), false)
+	}
+	doc.pair("Total XMR", utils.FormatXMR(transaction.Amount)+" XMR", true)
+	if transaction.ExchangeRate != nil {
+		doc.pair("Rate", "1 XMR = "+formatFiat(*transaction.ExchangeRate, transaction.Currency), false)
+	}
+	if transaction.AmountReceived != transaction.Amount {
+		doc.pair("Received", utils.FormatXMR(transaction.AmountReceived)+" XMR", false)
+	}
+	if transaction.AmountShortfall > 0 {
+		doc.pair("Short", utils.FormatXMR(transaction.AmountShortfall)+" XMR", false)
+	}
+
+	if len(transaction.SubTransactions) > 0 {
+		doc.rule()
+		doc.text("Payments")
+		for _, sub := range transaction.SubTransactions {
+			doc.text(sub.TxHash)
+			doc.pair("", utils.FormatXMR(sub.Amount)+" XMR", false)
+		}
+	}
+
+	if vendor.ReceiptFooter != nil {
+		doc.rule()
+		for _, footer := range strings.Split(*vendor.ReceiptFooter, "\n") {
+			doc.center(footer, false)
+		}
+	}
+
+	return doc
+}
+
+func formatFiat(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// layout wraps the document to width columns, returning one entry per printed line
+func (d *Document) layout(width int) []layoutLine {
+	var out []layoutLine
+	for _, l := range d.lines {
+		switch l.kind {
+		case lineRule:
+			out = append(out, layoutLine{text: strings.Repeat("-", width)})
+		case lineCenter:
+			for _, wrapped := range wrap(l.left, width) {
+				pad := (width - runeLen(wrapped)) / 2
+				out = append(out, layoutLine{text: strings.Repeat(" ", pad) + wrapped, bold: l.bold, center: true})
+			}
+		case linePair:
+			gap := width - runeLen(l.left) - runeLen(l.right)
+			if gap < 1 {
+				for _, wrapped := range wrap(l.left, width) {
+					out = append(out, layoutLine{text: wrapped, bold: l.bold})
+				}
+				right := wrap(l.right, width)
+				for _, wrapped := range right {
+					out = append(out, layoutLine{text: strings.Repeat(" ", width-runeLen(wrapped)) + wrapped, bold: l.bold})
+				}
+				continue
+			}
+			out = append(out, layoutLine{text: l.left + strings.Repeat(" ", gap) + l.right, bold: l.bold})
+		default:
+			for _, wrapped := range wrap(l.left, width) {
+				out = append(out, layoutLine{text: wrapped, bold: l.bold})
+			}
+		}
+	}
+	return out
+}
+
+type layoutLine struct {
+	text   string
+	bold   bool
+	center bool
+}
+
+// wrap breaks value into lines of at most width runes, on spaces where possible
+func wrap(value string, width int) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []string{""}
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(value) {
+		for runeLen(word) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case runeLen(current)+1+runeLen(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+func runeLen(value string) int {
+	return len([]rune(value))
+}
@@ -0,0 +1,118 @@
+package receipt
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// ESC/POS commands used by the renderer
+var (
+	escposInit        = []byte{0x1b, 0x40}
+	escposAlignLeft   = []byte{0x1b, 0x61, 0x00}
+	escposAlignCenter = []byte{0x1b, 0x61, 0x01}
+	escposBoldOn      = []byte{0x1b, 0x45, 0x01}
+	escposBoldOff     = []byte{0x1b, 0x45, 0x00}
+	escposFeedAndCut  = []byte{0x1d, 0x56, 0x42, 0x03} // Feed 3 lines, then partial cut
+)
+
+const maxEscposLogoHeight = 240
+
+// RenderEscPos prints the receipt as an ESC/POS byte stream for a thermal printer.
+// width is the number of columns, printers with up to 32 columns are treated as 58 mm (384 dots), wider ones as 80 mm (576 dots).
+func RenderEscPos(doc *Document, width int) []byte {
+	var b bytes.Buffer
+	b.Write(escposInit)
+
+	if doc.Logo != nil {
+		dots := 384
+		if width > 32 {
+			dots = 576
+		}
+		b.Write(escposAlignCenter)
+		writeEscposRaster(&b, doc.Logo, dots/2, maxEscposLogoHeight)
+		b.WriteByte('\n')
+	}
+
+	for _, l := range doc.layout(width) {
+		text := l.text
+		if l.center {
+			b.Write(escposAlignCenter)
+			text = strings.TrimSpace(text)
+		} else {
+			b.Write(escposAlignLeft)
+		}
+		if l.bold {
+			b.Write(escposBoldOn)
+		}
+		b.WriteString(toASCII(text))
+		b.WriteByte('\n')
+		if l.bold {
+			b.Write(escposBoldOff)
+		}
+	}
+
+	b.Write(escposAlignLeft)
+	b.Write(escposFeedAndCut)
+	return b.Bytes()
+}
+
+// writeEscposRaster prints img as a monochrome raster (GS v 0), scaled down to fit maxWidth x maxHeight dots
+func writeEscposRaster(b *bytes.Buffer, img image.Image, maxWidth int, maxHeight int) {
+	width, height := fitImage(img.Bounds(), maxWidth, maxHeight)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	bytesPerRow := (width + 7) / 8
+	b.Write([]byte{0x1d, 0x76, 0x30, 0x00, byte(bytesPerRow), byte(bytesPerRow >> 8), byte(height), byte(height >> 8)})
+
+	bounds := img.Bounds()
+	row := make([]byte, bytesPerRow)
+	for y := 0; y < height; y++ {
+		for i := range row {
+			row[i] = 0
+		}
+		srcY := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			srcX := bounds.Min.X + x*bounds.Dx()/width
+			if luminance(img.At(srcX, srcY)) < 128 {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		b.Write(row)
+	}
+}
+
+// fitImage scales bounds down, keeping the aspect ratio, until they fit maxWidth x maxHeight
+func fitImage(bounds image.Rectangle, maxWidth int, maxHeight int) (int, int) {
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
+
+// luminance of c composited onto white paper, 0 (black) to 255 (white)
+func luminance(c color.Color) uint32 {
+	r, g, b, a := c.RGBA()
+	white := 0xffff - a
+	r, g, b = r+white, g+white, b+white
+	return (299*r + 587*g + 114*b) / 1000 >> 8
+}
+
+// toASCII replaces characters the printer's default code page may not have
+func toASCII(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '?'
+		}
+		return r
+	}, value)
+}
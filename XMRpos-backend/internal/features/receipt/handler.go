@@ -0,0 +1,81 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+type ReceiptHandler struct {
+	service *ReceiptService
+}
+
+func NewReceiptHandler(service *ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{service: service}
+}
+
+// GetReceipt serves both POS and vendor tokens, a POS only gets receipts for its own transactions
+func (h *ReceiptHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	transactionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
+	if !ok || (role != "pos" && role != "vendor") {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	if vendorIDPtr == nil {
+		http.Error(w, "Vendor ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var posIDPtr *uint
+	if role == "pos" {
+		posIDPtr, _ = r.Context().Value(models.ClaimsPosIDKey).(*uint)
+		if posIDPtr == nil {
+			http.Error(w, "POS ID is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatText
+	}
+
+	width := DefaultWidth
+	if value := r.URL.Query().Get("width"); value != "" {
+		width, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid width", http.StatusBadRequest)
+			return
+		}
+	}
+
+	receipt, contentType, httpErr := h.service.GetReceipt(ctx, uint(transactionID), *vendorIDPtr, posIDPtr, format, width)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == FormatPDF {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%d.pdf"`, transactionID))
+	}
+	w.Write(receipt)
+}
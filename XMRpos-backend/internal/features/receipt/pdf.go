@@ -0,0 +1,127 @@
+package receipt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"strings"
+)
+
+const (
+	pdfFontSize    = 9.0
+	pdfLineHeight  = 11.0
+	pdfMargin      = 14.0
+	pdfCharWidth   = 0.6 * pdfFontSize // Courier advances 600/1000 em per glyph
+	pdfLogoMaxSize = 96.0
+)
+
+// RenderPDF prints the receipt as a single page PDF sized like a paper receipt, width is the number of columns
+func RenderPDF(doc *Document, width int) []byte {
+	lines := doc.layout(width)
+
+	pageWidth := float64(width)*pdfCharWidth + 2*pdfMargin
+	logoWidth, logoHeight := 0.0, 0.0
+	if doc.Logo != nil {
+		w, h := fitImage(doc.Logo.Bounds(), int(pdfLogoMaxSize), int(pdfLogoMaxSize))
+		logoWidth, logoHeight = float64(w), float64(h)
+	}
+	pageHeight := float64(len(lines))*pdfLineHeight + 2*pdfMargin
+	if logoHeight > 0 {
+		pageHeight += logoHeight + pdfLineHeight
+	}
+
+	var content bytes.Buffer
+	if logoHeight > 0 {
+		x := (pageWidth - logoWidth) / 2
+		y := pageHeight - pdfMargin - logoHeight
+		fmt.Fprintf(&content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n", logoWidth, logoHeight, x, y)
+	}
+	y := pageHeight - pdfMargin - pdfFontSize
+	if logoHeight > 0 {
+		y -= logoHeight + pdfLineHeight
+	}
+	for _, l := range lines {
+		font := "/F1"
+		if l.bold {
+			font = "/F2"
+		}
+		fmt.Fprintf(&content, "BT %s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, pdfFontSize, pdfMargin, y, escapePDFString(l.text))
+		y -= pdfLineHeight
+	}
+
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	objects = append(objects, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	resources := "/Font << /F1 4 0 R /F2 5 0 R >>"
+	if logoHeight > 0 {
+		resources += " /XObject << /Im1 7 0 R >>"
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << %s >> /Contents 6 0 R >>", pageWidth, pageHeight, resources))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, pdfStream("", content.Bytes()))
+	if logoHeight > 0 {
+		objects = append(objects, pdfImage(doc.Logo, int(logoWidth), int(logoHeight)))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func pdfStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s/Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// pdfImage embeds img scaled to width x height as a flate compressed RGB image, composited onto white
+func pdfImage(img image.Image, width int, height int) string {
+	bounds := img.Bounds()
+	var raw bytes.Buffer
+	zw := zlib.NewWriter(&raw)
+	pixel := make([]byte, 3)
+	for y := 0; y < height; y++ {
+		srcY := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			srcX := bounds.Min.X + x*bounds.Dx()/width
+			r, g, b, a := img.At(srcX, srcY).RGBA()
+			white := 0xffff - a
+			pixel[0], pixel[1], pixel[2] = byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8)
+			zw.Write(pixel)
+		}
+	}
+	zw.Close()
+
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode ", width, height)
+	return pdfStream(dict, raw.Bytes())
+}
+
+// escapePDFString escapes a literal string, characters outside WinAnsi (Latin-1 here) become '?'
+func escapePDFString(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		case r >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
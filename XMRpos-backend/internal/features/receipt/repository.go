@@ -0,0 +1,62 @@
+package receipt
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+type ReceiptRepository interface {
+	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
+	FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error)
+	FindPosByID(ctx context.Context, id uint) (*models.Pos, error)
+}
+
+type receiptRepository struct {
+	db *gorm.DB
+}
+
+func NewReceiptRepository(db *gorm.DB) ReceiptRepository {
+	return &receiptRepository{db: db}
+}
+
+func (r *receiptRepository) FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var transaction models.Transaction
+	if err := r.db.WithContext(ctx).
+		Preload("SubTransactions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("timestamp ASC, id ASC")
+		}).
+		Preload("LineItems", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (r *receiptRepository) FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var vendor models.Vendor
+	if err := r.db.WithContext(ctx).First(&vendor, id).Error; err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
+func (r *receiptRepository) FindPosByID(ctx context.Context, id uint) (*models.Pos, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var pos models.Pos
+	if err := r.db.WithContext(ctx).Select("id", "name", "vendor_id").First(&pos, id).Error; err != nil {
+		return nil, err
+	}
+	return &pos, nil
+}
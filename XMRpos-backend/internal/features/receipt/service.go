@@ -0,0 +1,84 @@
+package receipt
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatText   = "text"
+	FormatEscPos = "escpos"
+	FormatPDF    = "pdf"
+)
+
+const (
+	DefaultWidth = 32 // Columns of a 58 mm thermal printer
+	MinWidth     = 24
+	MaxWidth     = 64
+)
+
+var contentTypes = map[string]string{
+	FormatText:   "text/plain; charset=utf-8",
+	FormatEscPos: "application/octet-stream",
+	FormatPDF:    "application/pdf",
+}
+
+type ReceiptService struct {
+	repo ReceiptRepository
+}
+
+func NewReceiptService(repo ReceiptRepository) *ReceiptService {
+	return &ReceiptService{repo: repo}
+}
+
+// GetReceipt renders the receipt of a confirmed transaction owned by the vendor, and by the POS when posID is set.
+// It returns the rendered bytes with their content type.
+func (s *ReceiptService) GetReceipt(ctx context.Context, transactionID uint, vendorID uint, posID *uint, format string, width int) ([]byte, string, *models.HTTPError) {
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return nil, "", models.NewHTTPError(http.StatusBadRequest, "Invalid format")
+	}
+	if width < MinWidth || width > MaxWidth {
+		return nil, "", models.NewHTTPError(http.StatusBadRequest, "width must be between 24 and 64")
+	}
+
+	transaction, err := s.repo.FindTransactionByID(ctx, transactionID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", models.NewHTTPError(http.StatusNotFound, "Transaction not found")
+		}
+		return nil, "", models.NewHTTPError(http.StatusInternalServerError, "error retrieving transaction: "+err.Error())
+	}
+
+	if transaction.VendorID != vendorID || (posID != nil && transaction.PosID != *posID) {
+		return nil, "", models.NewHTTPError(http.StatusNotFound, "Transaction not found")
+	}
+
+	if !transaction.Confirmed {
+		return nil, "", models.NewHTTPError(http.StatusConflict, "Receipts are only available for confirmed transactions")
+	}
+
+	vendor, err := s.repo.FindVendorByID(ctx, transaction.VendorID)
+	if err != nil {
+		return nil, "", models.NewHTTPError(http.StatusInternalServerError, "error retrieving vendor: "+err.Error())
+	}
+
+	pos, err := s.repo.FindPosByID(ctx, transaction.PosID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, "", models.NewHTTPError(http.StatusInternalServerError, "error retrieving POS: "+err.Error())
+	}
+
+	doc := BuildDocument(vendor, pos, transaction)
+
+	switch format {
+	case FormatEscPos:
+		return RenderEscPos(doc, width), contentType, nil
+	case FormatPDF:
+		return RenderPDF(doc, width), contentType, nil
+	default:
+		return RenderText(doc, width), contentType, nil
+	}
+}
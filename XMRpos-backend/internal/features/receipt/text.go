@@ -0,0 +1,15 @@
+package receipt
+
+import (
+	"strings"
+)
+
+// RenderText prints the receipt as plain text, width is the number of columns
+func RenderText(doc *Document, width int) []byte {
+	var b strings.Builder
+	for _, l := range doc.layout(width) {
+		b.WriteString(strings.TrimRight(l.text, " "))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
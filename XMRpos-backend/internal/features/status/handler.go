@@ -0,0 +1,61 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type StatusHandler struct {
+	service *StatusService
+}
+
+func NewStatusHandler(service *StatusService) *StatusHandler {
+	return &StatusHandler{service: service}
+}
+
+// GetStatus needs no token, the unguessable public token in the path is the authorization
+func (h *StatusHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	status, httpErr := h.service.GetStatus(ctx, chi.URLParam(r, "token"))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// GetStatusPage renders the status for the customer, reloading itself until the status is final
+func (h *StatusHandler) GetStatusPage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	status, httpErr := h.service.GetStatus(ctx, chi.URLParam(r, "token"))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := renderPage(&page, status); err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Write(page.Bytes())
+}
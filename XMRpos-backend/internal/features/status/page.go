@@ -0,0 +1,103 @@
+package status
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+// Seconds between reloads of a page whose status can still change
+const pageRefreshSeconds = 5
+
+var pageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if not .Final}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>Payment status</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 28rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.2rem; }
+.state { font-size: 1.4rem; font-weight: bold; margin: 1rem 0; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: .4rem 0; border-bottom: 1px solid #ddd; }
+td:last-child { text-align: right; font-family: monospace; }
+.note { color: #666; font-size: .85rem; margin-top: 1rem; }
+</style>
+</head>
+<body>
+<h1>{{.Merchant}}</h1>
+<div class="state">{{.Label}}</div>
+<table>
+<tr><td>Total</td><td>{{.Amount}} XMR{{if .Fiat}}<br>{{.Fiat}}{{end}}</td></tr>
+<tr><td>Received</td><td>{{.Received}} XMR</td></tr>
+{{if .Due}}<tr><td>Due</td><td>{{.Due}} XMR</td></tr>{{end}}
+<tr><td>Confirmations</td><td>{{.Confirmations}} / {{.FinalConfirmations}}{{if lt .Required .FinalConfirmations}}<br>accepted at {{.Required}}{{end}}</td></tr>
+</table>
+{{if not .Final}}<p class="note">This page updates every {{.Refresh}} seconds.</p>{{end}}
+</body>
+</html>
+`))
+
+type pageData struct {
+	Merchant           string
+	Label              string
+	Amount             string
+	Fiat               string
+	Received           string
+	Due                string
+	Confirmations      int64
+	Required           int64
+	FinalConfirmations int64
+	Final              bool
+	Refresh            int
+}
+
+// statusLabel words the status for a customer
+func statusLabel(status *PublicStatus) string {
+	switch {
+	case status.Status == models.TransactionStatusCancelled && status.AmountReceived > 0:
+		return "Cancelled, a payment arrived anyway"
+	case status.Status == models.TransactionStatusCancelled:
+		return "Cancelled"
+	case status.Status == models.TransactionStatusExpired && status.AmountReceived > 0:
+		return "Expired, a payment arrived late"
+	case status.Status == models.TransactionStatusExpired:
+		return "Expired"
+	case status.Confirmed:
+		return "Payment confirmed"
+	case status.Status == models.TransactionStatusUnderpaid:
+		return "Partially paid"
+	case status.Accepted:
+		return "Payment accepted"
+	case status.AmountReceived > 0:
+		return "Payment received, waiting for confirmations"
+	default:
+		return "Waiting for payment"
+	}
+}
+
+func renderPage(w io.Writer, status *PublicStatus) error {
+	data := pageData{
+		Merchant:           status.Merchant,
+		Label:              statusLabel(status),
+		Amount:             utils.FormatXMR(status.Amount),
+		Received:           utils.FormatXMR(status.AmountReceived),
+		Confirmations:      status.Confirmations,
+		Required:           status.RequiredConfirmations,
+		FinalConfirmations: status.FinalConfirmations,
+		Final:              status.Final,
+		Refresh:            pageRefreshSeconds,
+	}
+	if status.AmountInCurrency > 0 {
+		data.Fiat = fmt.Sprintf("%.2f %s", status.AmountInCurrency, status.Currency)
+	}
+	if status.AmountDue > 0 {
+		data.Due = utils.FormatXMR(status.AmountDue)
+	}
+	return pageTemplate.Execute(w, data)
+}
@@ -0,0 +1,37 @@
+package status
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+type StatusRepository interface {
+	FindTransactionByPublicToken(ctx context.Context, token string) (*models.Transaction, error)
+}
+
+type statusRepository struct {
+	db *gorm.DB
+}
+
+func NewStatusRepository(db *gorm.DB) StatusRepository {
+	return &statusRepository{db: db}
+}
+
+func (r *statusRepository) FindTransactionByPublicToken(ctx context.Context, token string) (*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var transaction models.Transaction
+	if err := r.db.WithContext(ctx).
+		Preload("SubTransactions").
+		Preload("Vendor", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "receipt_company_name")
+		}).
+		Where("public_token = ?", token).
+		First(&transaction).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
@@ -0,0 +1,96 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+type StatusService struct {
+	repo StatusRepository
+}
+
+func NewStatusService(repo StatusRepository) *StatusService {
+	return &StatusService{repo: repo}
+}
+
+// PublicStatus is what the customer may see of a transaction, nothing that identifies the POS or the vendor account
+type PublicStatus struct {
+	Merchant              string     `json:"merchant"`
+	Status                string     `json:"status"`
+	Final                 bool       `json:"final"` // nothing will change anymore
+	Address               *string    `json:"address"`
+	Currency              string     `json:"currency"`
+	AmountInCurrency      float64    `json:"amount_in_currency"`
+	Amount                int64      `json:"amount"`
+	AmountReceived        int64      `json:"amount_received"`
+	AmountDue             int64      `json:"amount_due"`
+	RequiredConfirmations int64      `json:"required_confirmations"`
+	FinalConfirmations    int64      `json:"final_confirmations"`
+	Confirmations         int64      `json:"confirmations"` // of the least confirmed payment, 0 before any payment
+	Accepted              bool       `json:"accepted"`
+	Confirmed             bool       `json:"confirmed"`
+	ExpiresAt             *time.Time `json:"expires_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+func (s *StatusService) GetStatus(ctx context.Context, token string) (*PublicStatus, *models.HTTPError) {
+	// Tokens are 32 characters, anything else cannot match
+	if len(token) != 32 {
+		return nil, models.NewHTTPError(http.StatusNotFound, "transaction not found")
+	}
+
+	transaction, err := s.repo.FindTransactionByPublicToken(ctx, token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewHTTPError(http.StatusNotFound, "transaction not found")
+	}
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "DB error: "+err.Error())
+	}
+
+	merchant := transaction.Vendor.Name
+	if transaction.Vendor.ReceiptCompanyName != nil {
+		merchant = *transaction.Vendor.ReceiptCompanyName
+	}
+
+	status := &PublicStatus{
+		Merchant:              merchant,
+		Status:                transaction.Status,
+		Address:               transaction.SubAddress,
+		Currency:              transaction.Currency,
+		AmountInCurrency:      transaction.AmountInCurrency,
+		Amount:                transaction.Amount,
+		AmountReceived:        transaction.AmountReceived,
+		RequiredConfirmations: transaction.RequiredConfirmations,
+		FinalConfirmations:    transaction.FinalConfirmations,
+		Accepted:              transaction.Accepted,
+		Confirmed:             transaction.Confirmed,
+		ExpiresAt:             transaction.ExpiresAt,
+		UpdatedAt:             transaction.UpdatedAt,
+	}
+	if transaction.AmountReceived < transaction.Amount {
+		status.AmountDue = transaction.Amount - transaction.AmountReceived
+	}
+	counted := false
+	for _, sub := range transaction.SubTransactions {
+		if !sub.Orphaned && (!counted || sub.Confirmations < status.Confirmations) {
+			status.Confirmations = sub.Confirmations
+			counted = true
+		}
+	}
+
+	switch transaction.Status {
+	case models.TransactionStatusExpired, models.TransactionStatusCancelled:
+		// Nothing is due anymore, but a payment that arrived anyway still confirms
+		status.AmountDue = 0
+		status.Final = transaction.AmountReceived == 0 || transaction.Confirmed
+	default:
+		status.Final = transaction.Confirmed
+	}
+
+	return status, nil
+}
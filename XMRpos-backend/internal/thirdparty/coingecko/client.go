@@ -0,0 +1,68 @@
+package coingecko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultBaseURL = "https://api.coingecko.com/api/v3"
+
+// CoinGeckoAPIClient fetches public market prices from CoinGecko
+type CoinGeckoAPIClient struct {
+	BaseURL string
+	APIKey  string
+}
+
+func NewCoinGeckoAPIClient(baseURL string, apiKey string) *CoinGeckoAPIClient {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &CoinGeckoAPIClient{BaseURL: strings.TrimRight(baseURL, "/"), APIKey: apiKey}
+}
+
+var cgClient = &http.Client{Timeout: 10 * time.Second}
+
+// GetMoneroPrices returns the price of 1 XMR in each of the requested currencies, keyed by lower case currency code
+func (client *CoinGeckoAPIClient) GetMoneroPrices(ctx context.Context, currencies []string) (map[string]float64, error) {
+	query := url.Values{}
+	query.Set("ids", "monero")
+	query.Set("vs_currencies", strings.ToLower(strings.Join(currencies, ",")))
+	endpoint := fmt.Sprintf("%s/simple/price?%s", client.BaseURL, query.Encode())
+
+	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client.APIKey != "" {
+		req.Header.Set("x-cg-demo-api-key", client.APIKey)
+	}
+	resp, err := cgClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { io.Copy(io.Discard, resp.Body); resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch prices: %s", resp.Status)
+	}
+
+	var priceResp map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&priceResp); err != nil {
+		return nil, err
+	}
+
+	prices, ok := priceResp["monero"]
+	if !ok {
+		return nil, fmt.Errorf("no monero prices in response")
+	}
+
+	return prices, nil
+}